@@ -3,6 +3,7 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -15,24 +16,46 @@ import (
 const MaxFeatures = 1000
 
 func main() {
-	if len(os.Args) != 6 {
-		fmt.Fprintf(os.Stderr, "Usage: %s pos_dir neg_dir cascade_file retention exclusion\n",
-			os.Args[0])
+	var pool haar.FeaturePool
+	var types string
+	flag.StringVar(&types, "types", "", "comma-separated feature types (default the five basic types)")
+	flag.IntVar(&pool.MinWidth, "min-width", 0, "minimum feature width")
+	flag.IntVar(&pool.MinHeight, "min-height", 0, "minimum feature height")
+	flag.IntVar(&pool.PositionStep, "position-step", 1, "step between feature positions")
+	flag.IntVar(&pool.SizeStep, "size-step", 1, "step between feature part sizes")
+	flag.IntVar(&pool.MaxCount, "pool-size", 0, "maximum number of features (0 for no limit)")
+	flag.Int64Var(&pool.Seed, "seed", 0, "seed for choosing features")
+	mirror := flag.Bool("mirror", false, "add mirrored copies of the positive samples")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] pos_dir neg_dir cascade_file retention"+
+			" exclusion\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 5 {
+		flag.Usage()
 		os.Exit(1)
 	}
 
-	retention, err := strconv.ParseFloat(os.Args[4], 64)
+	retention, err := strconv.ParseFloat(args[3], 64)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Invalid retention:", os.Args[4])
+		fmt.Fprintln(os.Stderr, "Invalid retention:", args[3])
 		os.Exit(1)
 	}
-	exclusion, err := strconv.ParseFloat(os.Args[5], 64)
+	exclusion, err := strconv.ParseFloat(args[4], 64)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Invalid exclusion:", os.Args[4])
+		fmt.Fprintln(os.Stderr, "Invalid exclusion:", args[4])
+		os.Exit(1)
+	}
+	pool.Types, err = haar.ParseFeatureTypes(types)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 
-	cascadeData, err := ioutil.ReadFile(os.Args[3])
+	cascadeData, err := ioutil.ReadFile(args[2])
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Failed to read cascade:", err)
 		os.Exit(1)
@@ -45,12 +68,15 @@ func main() {
 
 	log.Println("Loading samples ...")
 
-	posDir, negDir := os.Args[1], os.Args[2]
+	posDir, negDir := args[0], args[1]
 	samples, err := haar.LoadSampleSource(posDir, negDir)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Failed to load samples:", err)
 		os.Exit(1)
 	}
+	if *mirror {
+		samples = haar.MirrorPositives(samples)
+	}
 
 	log.Println("Adding layer ...")
 
@@ -69,6 +95,15 @@ func main() {
 		NegativeExclusion: exclusion,
 		MaxFeatures:       MaxFeatures,
 	}}
+
+	// Layers are added with the same feature family as
+	// the existing cascade.
+	reqs[0].Pool = &pool
+	pool.LBP = usesLBP(&cascade)
+	if err := pool.Validate(cascade.WindowWidth, cascade.WindowHeight); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid feature pool:", err)
+		os.Exit(1)
+	}
 	haar.TrainMore(&cascade, reqs, samples, haar.ConsoleLogger{})
 
 	data, err := json.Marshal(&cascade)
@@ -76,8 +111,19 @@ func main() {
 		fmt.Fprintln(os.Stderr, "Failed to marshal data:", err)
 		os.Exit(1)
 	}
-	if err := ioutil.WriteFile(os.Args[3], data, 0755); err != nil {
+	if err := ioutil.WriteFile(args[2], data, 0755); err != nil {
 		fmt.Fprintln(os.Stderr, "Failed to write file:", err)
 		os.Exit(1)
 	}
 }
+
+func usesLBP(c *haar.Cascade) bool {
+	for _, layer := range c.Layers {
+		for _, f := range layer.Features {
+			if _, ok := f.(*haar.LBPFeature); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,300 @@
+package haar
+
+import (
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// DefaultLookupBins is the number of lookup table bins
+// used when Requirements.Bins is 0.
+const DefaultLookupBins = 64
+
+// A BoostingMode specifies the kind of weak classifiers
+// a layer is trained with.
+type BoostingMode int
+
+const (
+	// DiscreteAdaBoost trains weak classifiers which
+	// output a weight or its negative.
+	DiscreteAdaBoost BoostingMode = iota
+
+	// RealAdaBoost trains lookup tables.
+	// Each bin outputs half the log-odds of the positive
+	// and negative sample weights in that bin.
+	RealAdaBoost
+
+	// GentleAdaBoost trains lookup tables using weighted
+	// least squares.
+	// Each bin outputs a value between -1 and 1.
+	GentleAdaBoost
+)
+
+// trainWeightedLayer trains a layer of lookup tables or
+// decision trees by reweighting the samples after each
+// weak classifier is added.
+func trainWeightedLayer(reqs *Requirements, pos, neg []IntegralImage, features []WindowFeature,
+	l Logger) *Layer {
+	allSamples := make([]IntegralImage, len(pos)+len(neg))
+	copy(allSamples, pos)
+	copy(allSamples[len(pos):], neg)
+	desired := make(linalg.Vector, len(allSamples))
+	weights := make([]float64, len(allSamples))
+	indices := make([]int, len(allSamples))
+	posWeight := trainingPositiveBias * float64(len(neg)) / float64(len(pos))
+	for i := range pos {
+		desired[i] = 1
+		weights[i] = posWeight
+	}
+	for i := range neg {
+		desired[i+len(pos)] = -1
+		weights[i+len(pos)] = 1
+	}
+	for i := range indices {
+		indices[i] = i
+	}
+
+	bins := reqs.Bins
+	if bins == 0 {
+		bins = DefaultLookupBins
+	}
+
+	// Smoothing keeps the outputs of Real AdaBoost finite
+	// when only one kind of sample is present.
+	epsilon := 1 / float64(len(allSamples))
+
+	layer := &Layer{}
+	outputs := make(linalg.Vector, len(allSamples))
+	sampleOutputs := make([]float64, len(allSamples))
+	for i := 0; i < reqs.MaxFeatures; i++ {
+		var totalWeight float64
+		for _, w := range weights {
+			totalWeight += w
+		}
+		for j := range weights {
+			weights[j] /= totalWeight
+		}
+
+		var tree *DecisionTree
+		if reqs.TreeDepth > 0 {
+			tree = trainTree(reqs.Boosting, features, allSamples, desired, weights, indices,
+				reqs.TreeDepth, epsilon)
+			if tree.Feature == nil {
+				if len(layer.Features) > 0 {
+					break
+				}
+				// No split separates the samples, but the
+				// layer still needs a weak classifier, so it
+				// falls back to a lookup table.
+				tree = nil
+			}
+		}
+
+		var feature WindowFeature
+		weight := 1.0
+		if tree != nil {
+			var errorRate float64
+			for j, sample := range allSamples {
+				sampleOutputs[j] = tree.Classify(sample)
+				if sampleOutputs[j]*desired[j] < 0 {
+					errorRate += weights[j]
+				}
+			}
+			if reqs.Boosting == DiscreteAdaBoost {
+				weight = 0.5 * math.Log((1-errorRate+epsilon)/(errorRate+epsilon))
+			}
+			feature = tree.Feature
+			layer.Thresholds = append(layer.Thresholds, tree.Threshold)
+			layer.Trees = append(layer.Trees, tree)
+		} else {
+			var table *LookupTable
+			feature, table = bestLookupTable(reqs.Boosting, features, allSamples, desired,
+				weights, bins, epsilon)
+			for j, sample := range allSamples {
+				sampleOutputs[j] = table.Lookup(feature.Value(sample))
+			}
+			layer.Thresholds = append(layer.Thresholds, 0)
+			layer.Tables = append(layer.Tables, table)
+			if reqs.TreeDepth > 0 {
+				layer.Trees = append(layer.Trees, nil)
+			}
+		}
+		layer.Features = append(layer.Features, feature)
+		layer.Weights = append(layer.Weights, weight)
+
+		for j, output := range sampleOutputs {
+			outputs[j] += weight * output
+			weights[j] *= math.Exp(-desired[j] * weight * output)
+		}
+
+		layer.Threshold = necessaryThreshold(outputs, desired, reqs.PositiveRetention)
+		ret, exc := boostingScores(outputs, desired, layer.Threshold)
+		logLayerFeature(l, i+1, feature, outputs, desired, ret, exc)
+		if ret >= reqs.PositiveRetention && exc >= reqs.NegativeExclusion {
+			break
+		}
+	}
+
+	return layer
+}
+
+// logLayerFeature logs the latest feature of a layer.
+//
+// If the layer's threshold does not exclude any
+// negatives, the scores for a threshold of 0 are logged
+// instead.
+func logLayerFeature(l Logger, numFeatures int, f WindowFeature, outputs, desired linalg.Vector,
+	ret, exc float64) {
+	if l == nil {
+		return
+	}
+	if exc > 0 {
+		l.LogFeature(numFeatures, ret, exc, f)
+	} else {
+		rawRet, rawExc := boostingScores(outputs, desired, 0)
+		l.LogFeature(numFeatures, rawRet, rawExc, f)
+	}
+}
+
+// bestLookupTable finds the feature and lookup table
+// which minimize the boosting loss.
+func bestLookupTable(mode BoostingMode, features []WindowFeature, s []IntegralImage,
+	desired linalg.Vector, w []float64, bins int, epsilon float64) (WindowFeature, *LookupTable) {
+	idx := bestFeature(len(features), func(i int) float64 {
+		_, loss := fitLookupTable(mode, features[i], s, desired, w, bins, epsilon)
+		return loss
+	})
+	table, _ := fitLookupTable(mode, features[idx], s, desired, w, bins, epsilon)
+	return features[idx], table
+}
+
+// fitLookupTable creates the best lookup table for a
+// feature and returns the table's loss.
+//
+// Tables for categorical features have one bin for each
+// category.
+func fitLookupTable(mode BoostingMode, feature WindowFeature, s []IntegralImage,
+	desired linalg.Vector, w []float64, bins int, epsilon float64) (*LookupTable, float64) {
+	values := make([]float64, len(s))
+	table := &LookupTable{
+		Min: math.Inf(1),
+		Max: math.Inf(-1),
+	}
+	categorical, isCategorical := feature.(CategoricalFeature)
+	if isCategorical {
+		// Each category falls in the middle of its bin.
+		bins = categorical.NumCategories()
+		table.Min = -0.5
+		table.Max = float64(bins) - 0.5
+	}
+	table.Values = make([]float64, bins)
+	for i, sample := range s {
+		values[i] = feature.Value(sample)
+		if !isCategorical {
+			table.Min = math.Min(table.Min, values[i])
+			table.Max = math.Max(table.Max, values[i])
+		}
+	}
+
+	posWeights := make([]float64, bins)
+	negWeights := make([]float64, bins)
+	for i, value := range values {
+		if desired[i] > 0 {
+			posWeights[table.Bin(value)] += w[i]
+		} else {
+			negWeights[table.Bin(value)] += w[i]
+		}
+	}
+
+	var loss float64
+	for i, posWeight := range posWeights {
+		table.Values[i] = mode.leafOutput(posWeight, negWeights[i], epsilon)
+		loss += mode.leafLoss(posWeight, negWeights[i], epsilon)
+	}
+
+	return table, loss
+}
+
+// bestFeature computes the loss of every feature in
+// parallel and returns the index with the lowest loss.
+// Ties are broken in favor of earlier features.
+func bestFeature(numFeatures int, loss func(i int) float64) int {
+	indexChan := make(chan int, numFeatures)
+	for i := 0; i < numFeatures; i++ {
+		indexChan <- i
+	}
+	close(indexChan)
+
+	type featureLoss struct {
+		Index int
+		Loss  float64
+	}
+	lossChan := make(chan featureLoss)
+
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexChan {
+				lossChan <- featureLoss{Index: idx, Loss: loss(idx)}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(lossChan)
+	}()
+
+	best := featureLoss{Loss: math.Inf(1)}
+	for option := range lossChan {
+		if option.Loss < best.Loss || (option.Loss == best.Loss && option.Index < best.Index) {
+			best = option
+		}
+	}
+	return best.Index
+}
+
+// leafOutput computes the output of a lookup table bin
+// or tree leaf given the total weights of the positive
+// and negative samples which reach it.
+func (b BoostingMode) leafOutput(posWeight, negWeight, epsilon float64) float64 {
+	switch b {
+	case DiscreteAdaBoost:
+		if posWeight >= negWeight {
+			return 1
+		}
+		return -1
+	case RealAdaBoost:
+		return 0.5 * math.Log((posWeight+epsilon)/(negWeight+epsilon))
+	case GentleAdaBoost:
+		if posWeight+negWeight == 0 {
+			return 0
+		}
+		return (posWeight - negWeight) / (posWeight + negWeight)
+	default:
+		panic("unsupported boosting mode")
+	}
+}
+
+// leafLoss computes the contribution of a lookup table
+// bin or tree leaf to the loss.
+//
+// For DiscreteAdaBoost, this is the weighted error.
+// For RealAdaBoost, it is the sum of the new sample
+// weights.
+// For GentleAdaBoost, it is the weighted squared error.
+func (b BoostingMode) leafLoss(posWeight, negWeight, epsilon float64) float64 {
+	output := b.leafOutput(posWeight, negWeight, epsilon)
+	switch b {
+	case DiscreteAdaBoost:
+		return math.Min(posWeight, negWeight)
+	case RealAdaBoost:
+		return posWeight*math.Exp(-output) + negWeight*math.Exp(output)
+	default:
+		return posWeight*(1-output)*(1-output) + negWeight*(1+output)*(1+output)
+	}
+}
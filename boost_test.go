@@ -0,0 +1,146 @@
+package haar
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestLookupTable(t *testing.T) {
+	table := &LookupTable{Min: -1, Max: 3, Values: []float64{1, 2, 3, 4}}
+	inputs := []float64{-5, -1, -0.5, 0, 0.99, 1.5, 2.5, 3, 10}
+	expected := []int{0, 0, 0, 1, 1, 2, 3, 3, 3}
+	for i, x := range inputs {
+		if actual := table.Bin(x); actual != expected[i] {
+			t.Errorf("value %f: expected bin %d got %d", x, expected[i], actual)
+		}
+	}
+	if table.Lookup(1.5) != 3 {
+		t.Errorf("unexpected lookup: %f", table.Lookup(1.5))
+	}
+
+	flat := &LookupTable{Min: 2, Max: 2, Values: []float64{5, 6}}
+	if flat.Lookup(2) != 5 || flat.Lookup(7) != 5 {
+		t.Error("unexpected lookup in empty range")
+	}
+}
+
+func TestTrainLookupLayer(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	var pos, neg []IntegralImage
+	for i := 0; i < 60; i++ {
+		pos = append(pos, boostTestSample(gen, true))
+		neg = append(neg, boostTestSample(gen, false))
+	}
+	features := windowFeatures(AllFeatures(6, 6))
+
+	for _, mode := range []BoostingMode{RealAdaBoost, GentleAdaBoost} {
+		reqs := &Requirements{
+			PositiveRetention: 0.95,
+			NegativeExclusion: 0.9,
+			MaxFeatures:       10,
+			Boosting:          mode,
+			Bins:              8,
+		}
+		layer := trainLayer(reqs, pos, neg, features, nil)
+		if len(layer.Tables) != len(layer.Features) {
+			t.Errorf("mode %d: expected %d tables got %d", mode, len(layer.Features),
+				len(layer.Tables))
+			continue
+		}
+		for _, table := range layer.Tables {
+			if len(table.Values) != reqs.Bins {
+				t.Errorf("mode %d: expected %d bins got %d", mode, reqs.Bins,
+					len(table.Values))
+			}
+		}
+
+		var retained, excluded int
+		for _, x := range pos {
+			if layer.Classify(x) {
+				retained++
+			}
+		}
+		for _, x := range neg {
+			if !layer.Classify(x) {
+				excluded++
+			}
+		}
+		if ret := float64(retained) / float64(len(pos)); ret < reqs.PositiveRetention {
+			t.Errorf("mode %d: bad retention %f", mode, ret)
+		}
+		if exc := float64(excluded) / float64(len(neg)); exc < reqs.NegativeExclusion {
+			t.Errorf("mode %d: bad exclusion %f", mode, exc)
+		}
+
+		data, err := json.Marshal(layer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Layer
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		for i, x := range append(pos[:10:10], neg[:10]...) {
+			if decoded.Sum(x) != layer.Sum(x) {
+				t.Errorf("mode %d sample %d: decoded sum %f but expected %f", mode, i,
+					decoded.Sum(x), layer.Sum(x))
+			}
+		}
+	}
+}
+
+func TestLookupCascadeScan(t *testing.T) {
+	cascade := boostTestCascade()
+	compiled := cascade.Compile()
+	soft := NewSoftCascade(cascade)
+	img := NewDualImage(scanTestImage(70, 50, 3))
+	opts := &ScanOptions{Scale: 1.1, StrideX: 1.5}
+
+	expected, _ := cascade.ScanWithOptions(context.Background(), img, opts)
+	if len(expected) == 0 {
+		t.Fatal("expected some matches")
+	}
+	softMatches, _ := soft.ScanWithOptions(context.Background(), img, opts)
+	if !scanTestMatchesEqual(expected, softMatches) {
+		t.Error("soft cascade gave different matches")
+	}
+	compiledMatches, _ := compiled.ScanWithOptions(context.Background(), img, opts)
+	if len(compiledMatches) != len(expected) {
+		t.Fatalf("expected %d compiled matches got %d", len(expected), len(compiledMatches))
+	}
+	for i, x := range expected {
+		a := compiledMatches[i]
+		if x.X != a.X || x.Y != a.Y || x.Width != a.Width || math.Abs(x.Score-a.Score) > 1e-8 {
+			t.Errorf("match %d: expected %v got %v", i, x, a)
+		}
+	}
+}
+
+// boostTestSample creates a 6x6 training sample.
+// Positive samples have a bright left half.
+func boostTestSample(gen *rand.Rand, positive bool) IntegralImage {
+	pixels := make([]float64, 6*6)
+	for i := range pixels {
+		pixels[i] = gen.Float64() * 0.6
+		if positive && i%6 < 3 {
+			pixels[i] += 0.4
+		}
+	}
+	return NewDualImage(BitmapIntegralImage(pixels, 6, 6)).Window(0, 0, 6, 6)
+}
+
+// boostTestCascade creates a version of scanTestCascade
+// with lookup tables in its second layer.
+func boostTestCascade() *Cascade {
+	cascade := scanTestCascade()
+	layer := cascade.Layers[1]
+	layer.Tables = []*LookupTable{
+		nil,
+		{Min: -2, Max: 2, Values: []float64{-1, -0.5, 0.2, 0.6, 1}},
+		{Min: -1, Max: 1.5, Values: []float64{0.5, -0.3, 0.8}},
+	}
+	return cascade
+}
@@ -1,10 +1,8 @@
 package haar
 
-// These are defaults recommended in the original
-// Viola-Jones paper on face detection.
-const (
-	DefaultScanScale  = 1.25
-	DefaultScanStride = 1
+import (
+	"encoding/json"
+	"math"
 )
 
 // A Classifier classifies image windows.
@@ -18,7 +16,10 @@ type Classifier interface {
 // classifiers.
 type Layer struct {
 	// Features is all the features.
-	Features []*Feature
+	// Features which are not of the built-in Feature type
+	// must be registered with RegisterFeature for the
+	// layer to be decoded from JSON.
+	Features []WindowFeature
 
 	// Thresholds contains one threshold per feature.
 	// If a feature returns a value greater than its
@@ -31,24 +32,57 @@ type Layer struct {
 	// discretized into a 1 or -1.
 	Weights []float64
 
+	// Tables optionally contains one lookup table per
+	// feature.
+	// If Tables[i] is non-nil, the i-th feature's output
+	// is Weights[i] times the table's output for the
+	// feature's value, and Thresholds[i] is ignored.
+	Tables []*LookupTable `json:",omitempty"`
+
+	// Trees optionally contains one decision tree per
+	// feature.
+	// If Trees[i] is non-nil, the i-th feature's output
+	// is Weights[i] times the tree's output.
+	// In this case, Features[i] and Thresholds[i] are the
+	// root of the tree.
+	Trees []*DecisionTree `json:",omitempty"`
+
 	// If the weighted sum of the feature outputs
 	// is greater than Threshold, a sample is
 	// considered positive.
 	Threshold float64
 }
 
+// MarshalJSON encodes the layer, including the kinds of
+// its features.
+func (c *Layer) MarshalJSON() ([]byte, error) {
+	type layer Layer
+	return json.Marshal(&struct {
+		Features []*featureJSON
+		*layer
+	}{encodeFeatures(c.Features), (*layer)(c)})
+}
+
+// UnmarshalJSON decodes a layer encoded by MarshalJSON.
+func (c *Layer) UnmarshalJSON(data []byte) error {
+	type layer Layer
+	obj := struct {
+		Features []*featureJSON
+		*layer
+	}{layer: (*layer)(c)}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	c.Features = decodeFeatures(obj.Features)
+	return nil
+}
+
 // Sum returns the weighted sum of all the feature
 // outputs when run on an image window.
 func (c *Layer) Sum(img IntegralImage) float64 {
 	var sum float64
-	for i, feature := range c.Features {
-		var output float64
-		if feature.Value(img) > c.Thresholds[i] {
-			output = 1
-		} else {
-			output = -1
-		}
-		sum += c.Weights[i] * output
+	for i := range c.Features {
+		sum += c.output(i, img)
 	}
 	return sum
 }
@@ -59,6 +93,80 @@ func (c *Layer) Classify(img IntegralImage) bool {
 	return c.Sum(img) > c.Threshold
 }
 
+// output computes the weighted output of the i-th
+// feature classifier in the layer.
+func (c *Layer) output(i int, img IntegralImage) float64 {
+	if tree := c.tree(i); tree != nil {
+		return c.Weights[i] * tree.Classify(img)
+	}
+	if table := c.table(i); table != nil {
+		return c.Weights[i] * table.Lookup(c.Features[i].Value(img))
+	}
+	if c.Features[i].Value(img) > c.Thresholds[i] {
+		return c.Weights[i]
+	}
+	return -c.Weights[i]
+}
+
+// maxOutput returns the maximum absolute value of the
+// i-th feature classifier's weighted output.
+func (c *Layer) maxOutput(i int) float64 {
+	if tree := c.tree(i); tree != nil {
+		return math.Abs(c.Weights[i]) * tree.maxOutput()
+	}
+	if table := c.table(i); table != nil {
+		return math.Abs(c.Weights[i]) * table.maxOutput()
+	}
+	return math.Abs(c.Weights[i])
+}
+
+// table returns the lookup table for the i-th feature,
+// or nil if the feature is a stump.
+func (c *Layer) table(i int) *LookupTable {
+	if i < len(c.Tables) {
+		return c.Tables[i]
+	}
+	return nil
+}
+
+// tree returns the decision tree for the i-th feature,
+// or nil if the feature is not a tree.
+func (c *Layer) tree(i int) *DecisionTree {
+	if i < len(c.Trees) {
+		return c.Trees[i]
+	}
+	return nil
+}
+
+// scaled creates a version of the layer for windows
+// which are scaled by the given factors.
+func (c *Layer) scaled(xScale, yScale float64, width, height int) *Layer {
+	res := &Layer{
+		Features:   make([]WindowFeature, len(c.Features)),
+		Thresholds: make([]float64, len(c.Thresholds)),
+		Weights:    append([]float64{}, c.Weights...),
+		Threshold:  c.Threshold,
+	}
+	for i, feature := range c.Features {
+		scaled, areaScale := scaleFeature(feature, xScale, yScale, width, height)
+		res.Features[i] = scaled
+		res.Thresholds[i] = c.Thresholds[i] / areaScale
+		if table := c.table(i); table != nil {
+			if res.Tables == nil {
+				res.Tables = make([]*LookupTable, len(c.Features))
+			}
+			res.Tables[i] = table.scaled(areaScale)
+		}
+		if tree := c.tree(i); tree != nil {
+			if res.Trees == nil {
+				res.Trees = make([]*DecisionTree, len(c.Features))
+			}
+			res.Trees[i] = tree.scaled(xScale, yScale, width, height)
+		}
+	}
+	return res
+}
+
 // A Cascade classifies images by running them through
 // a series of classifiers, returning positive matches
 // only if every classifier in the series returns
@@ -81,61 +189,65 @@ func (c *Cascade) Classify(img IntegralImage) bool {
 	return true
 }
 
-// Scan looks for instances of this cascade within an
-// entire image.
-//
-// The cascade is scaled by various powers of scale to
-// find objects of different sizes.
-// If scale is 0, DefaultScanScale is used.
+// Sums runs the window through the cascade and returns
+// the sum from every layer that was evaluated.
 //
-// The cascade is moved horizontally and vertically
-// during scanning according to the stride argument.
-// If the stride is 0, DefaultScanStride is used.
-// The stride specifies how many pixels (relative to the
-// size of the cascade) to move the cascade for each
-// iteration of the scanning process.
-// A value of 1 means that the unscaled cascade is moved
-// one pixel at a time.
-//
-// The result may contain overlapping matches.
-func (c *Cascade) Scan(img *DualImage, scale, stride float64) Matches {
-	if scale == 0 {
-		scale = DefaultScanScale
-	}
-	if stride == 0 {
-		stride = DefaultScanStride
-	}
-
-	var res Matches
-	curScale := 1.0
-	for {
-		cropWidth := int(float64(c.WindowWidth)*curScale + 0.5)
-		cropHeight := int(float64(c.WindowHeight)*curScale + 0.5)
-		if cropWidth > img.Width() || cropHeight > img.Height() {
-			break
-		}
-
-		curStride := curScale * stride
-
-		for y := 0.0; int(y) <= img.Height()-cropHeight; y += curStride {
-			for x := 0.0; int(x) <= img.Width()-cropWidth; x += curStride {
-				cropping := img.Window(int(x), int(y), cropWidth, cropHeight)
-				if curScale != 1 {
-					cropping = ScaleIntegralImage(cropping, c.WindowWidth, c.WindowHeight)
-				}
-				if c.Classify(cropping) {
-					res = append(res, &Match{
-						X:      int(x),
-						Y:      int(y),
-						Width:  cropWidth,
-						Height: cropHeight,
-					})
-				}
-			}
+// If the window is rejected by some layer, the sums end
+// with the rejecting layer and ok is false.
+// Otherwise, there is one sum per layer and ok is true.
+func (c *Cascade) Sums(img IntegralImage) (sums []float64, ok bool) {
+	sums = make([]float64, 0, len(c.Layers))
+	for _, layer := range c.Layers {
+		sum := layer.Sum(img)
+		sums = append(sums, sum)
+		if sum <= layer.Threshold {
+			return sums, false
 		}
+	}
+	return sums, true
+}
 
-		curScale *= scale
+// Score computes a confidence score for a window that
+// was accepted by the cascade, given the layer sums as
+// returned by Sums.
+// The score is the amount by which the final layer's sum
+// exceeded its threshold.
+func (c *Cascade) Score(sums []float64) float64 {
+	if len(c.Layers) == 0 {
+		return 0
 	}
+	last := len(c.Layers) - 1
+	return sums[last] - c.Layers[last].Threshold
+}
 
+// Scaled creates a cascade which approximates this
+// cascade on windows of a different size.
+//
+// Unlike ScaleIntegralImage, which scales every window,
+// this scales every feature once up front.
+// The resulting cascade can be run directly on windows
+// of the new size.
+// The area compensation factor for each scaled feature
+// is folded into its threshold, so the layer sums of the
+// new cascade are comparable to those of the original.
+func (c *Cascade) Scaled(width, height int) *Cascade {
+	xScale := float64(width) / float64(c.WindowWidth)
+	yScale := float64(height) / float64(c.WindowHeight)
+	res := &Cascade{
+		Layers:       make([]*Layer, len(c.Layers)),
+		WindowWidth:  width,
+		WindowHeight: height,
+	}
+	for i, layer := range c.Layers {
+		res.Layers[i] = layer.scaled(xScale, yScale, width, height)
+	}
 	return res
 }
+
+func (c *Cascade) windowSize() (width, height int) {
+	return c.WindowWidth, c.WindowHeight
+}
+
+func (c *Cascade) scaledClassifier(width, height int) scanClassifier {
+	return c.Scaled(width, height)
+}
@@ -0,0 +1,190 @@
+package haar
+
+import (
+	"math"
+	"sort"
+)
+
+// clusterOverlaps groups matches whose overlap exceeds a
+// threshold.
+//
+// The result is identical to what one would get by
+// visiting the matches in order and comparing each one
+// to every match of every existing cluster, including
+// the order of the clusters and of the matches within
+// them.
+// Such a direct approach is quadratic, so instead, the
+// visited matches are stored in a spatial grid and only
+// the matches that intersect a new match are compared to
+// it.
+// Clusters are tracked with a union-find structure, and
+// their matches are kept in linked lists so that they can
+// be concatenated in constant time.
+func clusterOverlaps(m Matches, threshold float64, metric OverlapMetric) []Matches {
+	if len(m) == 0 {
+		return nil
+	}
+	if threshold < 0 {
+		// Every pair of matches is joined, even if they
+		// do not intersect.
+		return []Matches{append(Matches{}, m...)}
+	}
+
+	grid := newMatchGrid(m)
+	sets := newUnionFind(len(m))
+	next := make([]int, len(m))
+
+	type cluster struct {
+		head  int
+		tail  int
+		index int
+	}
+	var clusters []*cluster
+	clusterOf := make([]*cluster, len(m))
+
+	// seen[i] is j+1 if match i has been compared to
+	// match j.
+	seen := make([]int, len(m))
+
+	for j, match := range m {
+		var overlaps []int
+		grid.Query(match, func(i int) {
+			if seen[i] == j+1 {
+				return
+			}
+			seen[i] = j + 1
+			c := clusterOf[sets.Find(i)]
+			for _, idx := range overlaps {
+				if idx == c.index {
+					return
+				}
+			}
+			if metric.Overlap(m[i], match) > threshold {
+				overlaps = append(overlaps, c.index)
+			}
+		})
+		sort.Ints(overlaps)
+
+		next[j] = -1
+		if len(overlaps) == 0 {
+			c := &cluster{head: j, tail: j, index: len(clusters)}
+			clusters = append(clusters, c)
+			clusterOf[j] = c
+		} else {
+			first := clusters[overlaps[0]]
+			next[first.tail] = j
+			first.tail = j
+			for i := len(overlaps) - 1; i > 0; i-- {
+				k := overlaps[i]
+				c := clusters[k]
+				next[first.tail] = c.head
+				first.tail = c.tail
+				sets.Union(first.head, c.head)
+
+				last := clusters[len(clusters)-1]
+				last.index = k
+				clusters[k] = last
+				clusters = clusters[:len(clusters)-1]
+			}
+			sets.Union(first.head, j)
+			clusterOf[sets.Find(j)] = first
+		}
+		grid.Insert(j, match)
+	}
+
+	res := make([]Matches, len(clusters))
+	for i, c := range clusters {
+		for idx := c.head; idx != -1; idx = next[idx] {
+			res[i] = append(res[i], m[idx])
+		}
+	}
+	return res
+}
+
+// A matchGrid is a spatial index of matches.
+type matchGrid struct {
+	cellSize float64
+	cells    map[[2]int][]int
+}
+
+// newMatchGrid creates an empty grid with cells about as
+// large as the given matches.
+func newMatchGrid(m Matches) *matchGrid {
+	var size float64
+	for _, match := range m {
+		size += math.Max(float64(match.Width), float64(match.Height))
+	}
+	return &matchGrid{
+		cellSize: math.Max(1, size/float64(len(m))),
+		cells:    map[[2]int][]int{},
+	}
+}
+
+// Insert adds the match with the given index to the grid.
+func (g *matchGrid) Insert(idx int, m *Match) {
+	g.forEachCell(m, func(cell [2]int) {
+		g.cells[cell] = append(g.cells[cell], idx)
+	})
+}
+
+// Query calls f for the index of every match which might
+// intersect m.
+// The same index may be passed to f more than once.
+func (g *matchGrid) Query(m *Match, f func(idx int)) {
+	g.forEachCell(m, func(cell [2]int) {
+		for _, idx := range g.cells[cell] {
+			f(idx)
+		}
+	})
+}
+
+func (g *matchGrid) forEachCell(m *Match, f func(cell [2]int)) {
+	bounds := m.Bounds()
+	startX := int(math.Floor(float64(bounds.Min.X) / g.cellSize))
+	startY := int(math.Floor(float64(bounds.Min.Y) / g.cellSize))
+	endX := int(math.Floor(float64(bounds.Max.X) / g.cellSize))
+	endY := int(math.Floor(float64(bounds.Max.Y) / g.cellSize))
+	for y := startY; y <= endY; y++ {
+		for x := startX; x <= endX; x++ {
+			f([2]int{x, y})
+		}
+	}
+}
+
+// A unionFind is a disjoint-set forest.
+type unionFind struct {
+	parents []int
+	ranks   []int
+}
+
+func newUnionFind(n int) *unionFind {
+	res := &unionFind{parents: make([]int, n), ranks: make([]int, n)}
+	for i := range res.parents {
+		res.parents[i] = i
+	}
+	return res
+}
+
+// Find returns the root of the set containing i.
+func (u *unionFind) Find(i int) int {
+	for u.parents[i] != i {
+		u.parents[i] = u.parents[u.parents[i]]
+		i = u.parents[i]
+	}
+	return i
+}
+
+// Union merges the sets containing i and j.
+func (u *unionFind) Union(i, j int) {
+	i, j = u.Find(i), u.Find(j)
+	if i == j {
+		return
+	}
+	if u.ranks[i] < u.ranks[j] {
+		i, j = j, i
+	}
+	u.parents[j] = i
+	if u.ranks[i] == u.ranks[j] {
+		u.ranks[i]++
+	}
+}
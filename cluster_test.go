@@ -0,0 +1,135 @@
+package haar
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestClusterOverlaps(t *testing.T) {
+	for seed := int64(0); seed < 3; seed++ {
+		matches := clusterTestMatches(1000, 640, 480, seed)
+		if seed == 2 {
+			for i, match := range matches {
+				match.Angle = float64(i%5-2) * 0.1
+			}
+		}
+		for _, metric := range []OverlapMetric{SmallerAreaOverlap, IoUOverlap} {
+			for _, threshold := range []float64{-1, 0, 0.3, 0.7} {
+				expected := clusterOverlapsReference(matches, threshold, metric)
+				actual := clusterOverlaps(matches, threshold, metric)
+				if len(actual) != len(expected) {
+					t.Fatalf("seed %d metric %d threshold %f: expected %d clusters got %d",
+						seed, metric, threshold, len(expected), len(actual))
+				}
+				for i, cluster := range expected {
+					if len(actual[i]) != len(cluster) {
+						t.Fatalf("seed %d metric %d threshold %f: cluster %d differs",
+							seed, metric, threshold, i)
+					}
+					for j, match := range cluster {
+						if actual[i][j] != match {
+							t.Fatalf("seed %d metric %d threshold %f: cluster %d differs",
+								seed, metric, threshold, i)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkJoinOverlaps(b *testing.B) {
+	matches := clusterTestMatches(100000, 3840, 2160, 0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		matches.JoinOverlaps(0.7)
+	}
+}
+
+func BenchmarkJoinOverlapsSparse(b *testing.B) {
+	gen := rand.New(rand.NewSource(0))
+	var matches Matches
+	for i := 0; i < 100000; i++ {
+		matches = append(matches, testMatch(gen.Intn(3840), gen.Intn(2160), 24, 24))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		matches.JoinOverlaps(0.7)
+	}
+}
+
+func BenchmarkJoinOverlapsReference(b *testing.B) {
+	matches := clusterTestMatches(10000, 3840, 2160, 0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clusterOverlapsReference(matches, 0.7, SmallerAreaOverlap)
+	}
+}
+
+// clusterTestMatches creates raw matches like those of a
+// dense scan, with many matches around each object and
+// some scattered false positives.
+func clusterTestMatches(count, width, height int, seed int64) Matches {
+	gen := rand.New(rand.NewSource(seed))
+	objects := make([]*Match, count/200+1)
+	for i := range objects {
+		size := 24 + gen.Intn(200)
+		objects[i] = testMatch(gen.Intn(width), gen.Intn(height), size, size)
+	}
+
+	var res Matches
+	for len(res) < count {
+		if gen.Intn(10) == 0 {
+			size := 24 + gen.Intn(100)
+			res = append(res, &Match{X: gen.Intn(width), Y: gen.Intn(height),
+				Width: size, Height: size, Score: gen.Float64()})
+			continue
+		}
+		obj := objects[gen.Intn(len(objects))]
+		jitter := obj.Width/4 + 1
+		size := obj.Width + gen.Intn(jitter) - jitter/2
+		res = append(res, &Match{
+			X:      obj.X + gen.Intn(jitter) - jitter/2,
+			Y:      obj.Y + gen.Intn(jitter) - jitter/2,
+			Width:  size,
+			Height: size,
+			Score:  gen.Float64(),
+		})
+	}
+	return res
+}
+
+// clusterOverlapsReference is the direct quadratic
+// version of clusterOverlaps.
+func clusterOverlapsReference(m Matches, threshold float64, metric OverlapMetric) []Matches {
+	var clusters []Matches
+
+	for _, match := range m {
+		var overlaps []int
+		for i, cluster := range clusters {
+			var max float64
+			for _, x := range cluster {
+				if o := metric.Overlap(x, match); o > max {
+					max = o
+				}
+			}
+			if max > threshold {
+				overlaps = append(overlaps, i)
+			}
+		}
+		if len(overlaps) == 0 {
+			clusters = append(clusters, Matches{match})
+		} else {
+			first := overlaps[0]
+			clusters[first] = append(clusters[first], match)
+			for i := len(overlaps) - 1; i > 0; i-- {
+				k := overlaps[i]
+				clusters[first] = append(clusters[first], clusters[k]...)
+				clusters[k] = clusters[len(clusters)-1]
+				clusters = clusters[:len(clusters)-1]
+			}
+		}
+	}
+
+	return clusters
+}
@@ -0,0 +1,546 @@
+package haar
+
+import (
+	"context"
+	"math"
+)
+
+// A CompiledCascade is a flattened version of a Cascade
+// which can be evaluated quickly on a DualImage.
+//
+// Every feature is stored as a list of corners in the
+// integral image along with a weight for each corner.
+// Thus, evaluating a window requires no interface calls
+// or memory allocations, unless the cascade has features
+// of some kind other than Feature.
+// Such features are evaluated on windows of the image.
+//
+// A CompiledCascade gives the same matches as scanning
+// the original Cascade in ScaleWindows mode, although the
+// scores may differ slightly due to rounding.
+type CompiledCascade struct {
+	width  int
+	height int
+
+	// layerEnds stores, for each layer, the index of the
+	// feature after the layer's last feature.
+	layerEnds       []int
+	layerThresholds []float64
+
+	// featureEnds stores, for each feature, the index of
+	// the corner after the feature's last corner.
+	// The features of non-root tree nodes come after the
+	// features of every layer.
+	featureEnds       []int
+	featureThresholds []float64
+	featureWeights    []float64
+	featureTables     []*LookupTable
+
+	// featureTrees stores, for each layer feature, the
+	// index of its root tree node, or -1.
+	featureTrees []int
+
+	// Tree nodes are stored with their feature index and
+	// child node indices.
+	// The children of a leaf node are -1.
+	nodeFeatures   []int
+	nodeThresholds []float64
+	nodeOutputs    []float64
+	nodeLow        []int
+	nodeHigh       []int
+
+	cornerX       []int
+	cornerY       []int
+	cornerWeights []float64
+
+	// features stores every feature, so that the corners
+	// of tilted features can be recomputed for each plan.
+	features []WindowFeature
+	tilted   bool
+
+	// custom indicates which features are not of the
+	// built-in type.
+	// It is nil if every feature is built-in.
+	custom []bool
+
+	native *compiledPlan
+}
+
+// A compiledPlan stores corner positions for evaluating
+// a compiled cascade on windows of a certain size.
+type compiledPlan struct {
+	width  int
+	height int
+
+	cornerX []int
+	cornerY []int
+
+	// areaTerms stores, for each feature, the weighted sum
+	// of the areas above and to the left of its corners.
+	// This is used to account for the mean brightness of
+	// a window without normalizing every corner.
+	areaTerms []float64
+
+	areaScale float64
+
+	// Tilted features are scaled like Feature.Scaled,
+	// since their corners cannot be scaled individually.
+	// These fields are nil if there are no tilted features.
+	// The tiltedScales entry for an upright feature is 0.
+	tiltedEnds    []int
+	tiltedX       []int
+	tiltedY       []int
+	tiltedWeights []float64
+	tiltedTerms   []float64
+	tiltedScales  []float64
+}
+
+// A compiledImage provides the integrals of an image to
+// a compiled cascade without copying them.
+type compiledImage struct {
+	integrals integralTable
+	squares   integralTable
+	tilted    []float64
+	stride    int
+
+	// dual is used to evaluate custom features.
+	dual *DualImage
+}
+
+// Compile creates a CompiledCascade from the cascade.
+//
+// The compiled cascade does not reference the original,
+// so later changes to c will not be reflected in it.
+func (c *Cascade) Compile() *CompiledCascade {
+	res := &CompiledCascade{
+		width:  c.WindowWidth,
+		height: c.WindowHeight,
+	}
+	var trees []*DecisionTree
+	for _, layer := range c.Layers {
+		for i, feature := range layer.Features {
+			res.addFeature(feature)
+			trees = append(trees, layer.tree(i))
+			res.featureThresholds = append(res.featureThresholds, layer.Thresholds[i])
+			res.featureWeights = append(res.featureWeights, layer.Weights[i])
+			var table *LookupTable
+			if t := layer.table(i); t != nil {
+				table = t.copy()
+			}
+			res.featureTables = append(res.featureTables, table)
+		}
+		res.layerEnds = append(res.layerEnds, len(res.featureEnds))
+		res.layerThresholds = append(res.layerThresholds, layer.Threshold)
+	}
+	for i, tree := range trees {
+		root := -1
+		if tree != nil {
+			root = res.addTree(tree, i)
+		}
+		res.featureTrees = append(res.featureTrees, root)
+	}
+	res.native = res.plan(c.WindowWidth, c.WindowHeight)
+	return res
+}
+
+// Classify classifies the window of the image at the
+// given coordinates, using the cascade's native window
+// size.
+func (c *CompiledCascade) Classify(img *DualImage, x, y int) bool {
+	if x < 0 || y < 0 {
+		panic("window coordinates cannot be negative")
+	}
+	if x+c.width > img.Width() || y+c.height > img.Height() {
+		panic("window goes out of bounds")
+	}
+	compiled := c.image(img)
+	return c.evaluate(c.native, &compiled, x, y, nil)
+}
+
+// Scan is like Cascade.Scan, but for a compiled cascade.
+//
+// Scan allocates a fixed amount of memory for each scale
+// level and each row, plus a Match and a copy of its
+// LayerSums for every match.
+// Evaluating a window does not allocate, so rejecting
+// more windows does not cause more allocations, unless
+// the cascade has features of some kind other than
+// Feature.
+func (c *CompiledCascade) Scan(img *DualImage, scale, stride float64) Matches {
+	res, _ := c.ScanWithOptions(context.Background(), img, &ScanOptions{
+		Scale:   scale,
+		StrideX: stride,
+		StrideY: stride,
+	})
+	return res
+}
+
+// ScanWithOptions is like Cascade.ScanWithOptions, but
+// for a compiled cascade.
+//
+// The Mode field of the options is ignored, since the
+// compiled cascade always scans like ScaleWindows.
+// Memory is allocated like in Scan, plus the goroutines
+// and buffers for each level when Workers is above 1.
+func (c *CompiledCascade) ScanWithOptions(ctx context.Context, img *DualImage,
+	opts *ScanOptions) (Matches, error) {
+	if opts == nil {
+		opts = &ScanOptions{}
+	}
+	compiled := c.image(img)
+
+	levels := scanLevels(img, c.width, c.height, opts)
+	plans := map[*scanLevel]*compiledPlan{}
+	for _, level := range levels {
+		if level.scale == 1 {
+			plans[level] = c.native
+		} else {
+			plans[level] = c.plan(level.width, level.height)
+		}
+	}
+
+	return runScan(ctx, levels, opts, func(level *scanLevel, y int) Matches {
+		plan := plans[level]
+		sums := make([]float64, len(c.layerEnds))
+		var res Matches
+		for _, x := range level.columns {
+			if c.evaluate(plan, &compiled, x, y, sums) {
+				res = append(res, &Match{
+					X:         x,
+					Y:         y,
+					Width:     level.width,
+					Height:    level.height,
+					Score:     c.score(sums),
+					LayerSums: append([]float64{}, sums...),
+					Scale:     level.scale,
+					Count:     1,
+				})
+			}
+		}
+		return res
+	})
+}
+
+func (c *CompiledCascade) image(img *DualImage) compiledImage {
+	res := compiledImage{
+		integrals: newIntegralTable(img.image),
+		squares:   newIntegralTable(img.squared),
+		stride:    img.Width() + 1,
+		dual:      img,
+	}
+	if c.tilted {
+		res.tilted = img.tiltedTable().integrals
+	}
+	return res
+}
+
+func (c *CompiledCascade) score(sums []float64) float64 {
+	if len(sums) == 0 {
+		return 0
+	}
+	return sums[len(sums)-1] - c.layerThresholds[len(sums)-1]
+}
+
+// plan computes the corner positions for windows of the
+// given size, rounding them the same way as
+// ScaleIntegralImage.
+func (c *CompiledCascade) plan(width, height int) *compiledPlan {
+	xScale := float64(c.width) / float64(width)
+	yScale := float64(c.height) / float64(height)
+	xUnscale, yUnscale := 1/xScale, 1/yScale
+
+	res := &compiledPlan{
+		width:     width,
+		height:    height,
+		cornerX:   make([]int, len(c.cornerX)),
+		cornerY:   make([]int, len(c.cornerY)),
+		areaTerms: make([]float64, len(c.featureEnds)),
+		areaScale: xScale * yScale,
+	}
+	if width == c.width && height == c.height {
+		copy(res.cornerX, c.cornerX)
+		copy(res.cornerY, c.cornerY)
+		res.areaScale = 1
+	} else {
+		for i, x := range c.cornerX {
+			res.cornerX[i] = int(float64(x)*xUnscale + 0.5)
+		}
+		for i, y := range c.cornerY {
+			res.cornerY[i] = int(float64(y)*yUnscale + 0.5)
+		}
+	}
+
+	var cornerIdx int
+	for i, end := range c.featureEnds {
+		for ; cornerIdx < end; cornerIdx++ {
+			area := float64(res.cornerX[cornerIdx] * res.cornerY[cornerIdx])
+			res.areaTerms[i] += c.cornerWeights[cornerIdx] * area
+		}
+	}
+
+	if c.tilted {
+		res.tiltedEnds = make([]int, len(c.features))
+		res.tiltedTerms = make([]float64, len(c.features))
+		res.tiltedScales = make([]float64, len(c.features))
+		for i, feature := range c.features {
+			if haarFeature, ok := feature.(*Feature); ok && haarFeature.Type.Tilted() {
+				scaled, areaScale := haarFeature.scaled(xUnscale, yUnscale, width, height)
+				xs, ys, weights := featureCorners(&scaled, width, height)
+				res.tiltedX = append(res.tiltedX, xs...)
+				res.tiltedY = append(res.tiltedY, ys...)
+				res.tiltedWeights = append(res.tiltedWeights, weights...)
+				for j, y := range ys {
+					res.tiltedTerms[i] += weights[j] * float64(y*y)
+				}
+				res.tiltedScales[i] = areaScale
+			}
+			res.tiltedEnds[i] = len(res.tiltedX)
+		}
+	}
+
+	return res
+}
+
+// evaluate runs the cascade on a window.
+// If sums is non-nil, the layer sums are stored in it.
+func (c *CompiledCascade) evaluate(plan *compiledPlan, img *compiledImage, x, y int,
+	sums []float64) bool {
+	integrals, squares, stride := &img.integrals, &img.squares, img.stride
+	base := x + stride*y
+	right := base + plan.width
+	bottom := base + stride*plan.height
+	bottomRight := bottom + plan.width
+
+	area := float64(plan.width * plan.height)
+	totalSum := integrals.at(bottomRight) + integrals.at(base) -
+		(integrals.at(right) + integrals.at(bottom))
+	squareSum := squares.at(bottomRight) + squares.at(base) -
+		(squares.at(right) + squares.at(bottom))
+	mean := totalSum / area
+	stddev := math.Sqrt(squareSum/area - mean*mean)
+	valueScale := plan.areaScale / stddev
+
+	var featureIdx, cornerIdx int
+	for layerIdx, layerEnd := range c.layerEnds {
+		var sum float64
+		for ; featureIdx < layerEnd; featureIdx++ {
+			var rawValue float64
+			for end := c.featureEnds[featureIdx]; cornerIdx < end; cornerIdx++ {
+				offset := base + plan.cornerX[cornerIdx] + stride*plan.cornerY[cornerIdx]
+				rawValue += c.cornerWeights[cornerIdx] * integrals.at(offset)
+			}
+			value := (rawValue - mean*plan.areaTerms[featureIdx]) * valueScale
+			if plan.tiltedScales != nil && plan.tiltedScales[featureIdx] != 0 {
+				value = c.tiltedValue(plan, img, base, mean, stddev, featureIdx)
+			} else if c.custom != nil && c.custom[featureIdx] {
+				value = c.customValue(plan, img, base, featureIdx)
+			}
+			if root := c.featureTrees[featureIdx]; root >= 0 {
+				node := root
+				for c.nodeLow[node] >= 0 {
+					if node != root {
+						value = c.featureValue(plan, img, base, mean, stddev,
+							c.nodeFeatures[node])
+					}
+					if value > c.nodeThresholds[node] {
+						node = c.nodeHigh[node]
+					} else {
+						node = c.nodeLow[node]
+					}
+				}
+				sum += c.featureWeights[featureIdx] * c.nodeOutputs[node]
+			} else if table := c.featureTables[featureIdx]; table != nil {
+				sum += c.featureWeights[featureIdx] * table.Lookup(value)
+			} else if value > c.featureThresholds[featureIdx] {
+				sum += c.featureWeights[featureIdx]
+			} else {
+				sum -= c.featureWeights[featureIdx]
+			}
+		}
+		if sums != nil {
+			sums[layerIdx] = sum
+		}
+		if sum <= c.layerThresholds[layerIdx] {
+			return false
+		}
+	}
+	return true
+}
+
+// featureValue computes the value of a feature at the
+// window with the given base offset.
+func (c *CompiledCascade) featureValue(plan *compiledPlan, img *compiledImage, base int,
+	mean, stddev float64, featureIdx int) float64 {
+	if plan.tiltedScales != nil && plan.tiltedScales[featureIdx] != 0 {
+		return c.tiltedValue(plan, img, base, mean, stddev, featureIdx)
+	}
+	if c.custom != nil && c.custom[featureIdx] {
+		return c.customValue(plan, img, base, featureIdx)
+	}
+	var cornerIdx int
+	if featureIdx > 0 {
+		cornerIdx = c.featureEnds[featureIdx-1]
+	}
+	var rawValue float64
+	for end := c.featureEnds[featureIdx]; cornerIdx < end; cornerIdx++ {
+		offset := base + plan.cornerX[cornerIdx] + img.stride*plan.cornerY[cornerIdx]
+		rawValue += c.cornerWeights[cornerIdx] * img.integrals.at(offset)
+	}
+	return (rawValue - mean*plan.areaTerms[featureIdx]) * plan.areaScale / stddev
+}
+
+// tiltedValue is like featureValue, but for a tilted
+// feature.
+func (c *CompiledCascade) tiltedValue(plan *compiledPlan, img *compiledImage, base int,
+	mean, stddev float64, featureIdx int) float64 {
+	var cornerIdx int
+	if featureIdx > 0 {
+		cornerIdx = plan.tiltedEnds[featureIdx-1]
+	}
+	var rawValue float64
+	for end := plan.tiltedEnds[featureIdx]; cornerIdx < end; cornerIdx++ {
+		offset := base + plan.tiltedX[cornerIdx] + img.stride*plan.tiltedY[cornerIdx]
+		rawValue += plan.tiltedWeights[cornerIdx] * img.tilted[offset]
+	}
+	return (rawValue - mean*plan.tiltedTerms[featureIdx]) / stddev *
+		plan.tiltedScales[featureIdx]
+}
+
+// customValue is like featureValue, but for a feature
+// which is not of the built-in type.
+// The feature is evaluated on the window the same way as
+// in ScaleWindows mode.
+func (c *CompiledCascade) customValue(plan *compiledPlan, img *compiledImage, base int,
+	featureIdx int) float64 {
+	x, y := base%img.stride, base/img.stride
+	window := img.dual.Window(x, y, plan.width, plan.height)
+	if plan.width != c.width || plan.height != c.height {
+		window = ScaleIntegralImage(window, c.width, c.height)
+	}
+	return c.features[featureIdx].Value(window)
+}
+
+// addFeature adds the corners of a feature.
+// The corners of tilted features are stored in plans,
+// and custom features have no corners.
+func (c *CompiledCascade) addFeature(f WindowFeature) {
+	c.features = append(c.features, f)
+	haarFeature, ok := f.(*Feature)
+	if !ok {
+		if c.custom == nil {
+			c.custom = make([]bool, len(c.featureEnds))
+		}
+		c.custom = append(c.custom, true)
+		c.featureEnds = append(c.featureEnds, len(c.cornerX))
+		return
+	}
+	if c.custom != nil {
+		c.custom = append(c.custom, false)
+	}
+	if haarFeature.Type.Tilted() {
+		c.tilted = true
+		c.featureEnds = append(c.featureEnds, len(c.cornerX))
+		return
+	}
+	xs, ys, weights := featureCorners(haarFeature, c.width, c.height)
+	c.cornerX = append(c.cornerX, xs...)
+	c.cornerY = append(c.cornerY, ys...)
+	c.cornerWeights = append(c.cornerWeights, weights...)
+	c.featureEnds = append(c.featureEnds, len(c.cornerX))
+}
+
+// addTree adds the nodes of a tree and returns the index
+// of the root node.
+// The root's feature must already have been added at
+// index featureIdx.
+func (c *CompiledCascade) addTree(tree *DecisionTree, featureIdx int) int {
+	idx := len(c.nodeOutputs)
+	c.nodeFeatures = append(c.nodeFeatures, featureIdx)
+	c.nodeThresholds = append(c.nodeThresholds, tree.Threshold)
+	c.nodeOutputs = append(c.nodeOutputs, tree.Output)
+	c.nodeLow = append(c.nodeLow, -1)
+	c.nodeHigh = append(c.nodeHigh, -1)
+	if tree.Feature != nil {
+		c.nodeLow[idx] = c.addSubtree(tree.Low)
+		c.nodeHigh[idx] = c.addSubtree(tree.High)
+	}
+	return idx
+}
+
+func (c *CompiledCascade) addSubtree(tree *DecisionTree) int {
+	featureIdx := -1
+	if tree.Feature != nil {
+		c.addFeature(tree.Feature)
+		featureIdx = len(c.featureEnds) - 1
+	}
+	return c.addTree(tree, featureIdx)
+}
+
+// featureCorners finds the integral image coordinates
+// which a feature depends on, along with the coefficient
+// of each coordinate in the feature's value.
+//
+// This relies on the fact that a feature's value is a
+// linear combination of integrals.
+func featureCorners(f *Feature, width, height int) (xs, ys []int, weights []float64) {
+	probe := &probeImage{width: width, height: height, seen: map[[2]int]bool{}}
+	f.Value(probe)
+	probe.probing = true
+	for _, point := range probe.points {
+		probe.target = point
+		if weight := f.Value(probe); weight != 0 {
+			xs = append(xs, point[0])
+			ys = append(ys, point[1])
+			weights = append(weights, weight)
+		}
+	}
+	return
+}
+
+// A probeImage is an IntegralImage for determining how a
+// feature depends on each integral.
+//
+// Before probing, it records every coordinate which is
+// accessed.
+// While probing, the integral at the target coordinate
+// is 1, and all other integrals are 0.
+type probeImage struct {
+	width  int
+	height int
+
+	points [][2]int
+	seen   map[[2]int]bool
+
+	probing bool
+	target  [2]int
+}
+
+func (p *probeImage) Width() int {
+	return p.width
+}
+
+func (p *probeImage) Height() int {
+	return p.height
+}
+
+func (p *probeImage) IntegralAt(x, y int) float64 {
+	point := [2]int{x, y}
+	if !p.probing {
+		if !p.seen[point] {
+			p.seen[point] = true
+			p.points = append(p.points, point)
+		}
+		return 0
+	}
+	if point == p.target {
+		return 1
+	}
+	return 0
+}
+
+// TiltedIntegralAt is like IntegralAt.
+// Since a feature uses either tilted or upright integrals
+// but not both, the two do not need to be distinguished.
+func (p *probeImage) TiltedIntegralAt(x, y int) float64 {
+	return p.IntegralAt(x, y)
+}
@@ -0,0 +1,182 @@
+package haar
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestCompiledClassify(t *testing.T) {
+	cascade := scanTestCascade()
+	compiled := cascade.Compile()
+	img := NewDualImage(scanTestImage(30, 20, 8))
+	var positives int
+	for y := 0; y+cascade.WindowHeight <= img.Height(); y++ {
+		for x := 0; x+cascade.WindowWidth <= img.Width(); x++ {
+			window := img.Window(x, y, cascade.WindowWidth, cascade.WindowHeight)
+			expected := cascade.Classify(window)
+			if actual := compiled.Classify(img, x, y); actual != expected {
+				t.Errorf("window %d,%d: expected %v got %v", x, y, expected, actual)
+			}
+			if expected {
+				positives++
+			}
+		}
+	}
+	if positives == 0 {
+		t.Error("expected some positives")
+	}
+}
+
+func TestCompiledClassifyFormats(t *testing.T) {
+	cascade := scanTestCascade()
+	compiled := cascade.Compile()
+	formats := []IntegralFormat{Float32Integrals, Uint32Integrals, Uint64Integrals}
+	for _, format := range formats {
+		img := NewDualImageFormat(scanTestImage(30, 20, 8), format)
+		for y := 0; y+cascade.WindowHeight <= img.Height(); y++ {
+			for x := 0; x+cascade.WindowWidth <= img.Width(); x++ {
+				window := img.Window(x, y, cascade.WindowWidth, cascade.WindowHeight)
+				expected := cascade.Classify(window)
+				if actual := compiled.Classify(img, x, y); actual != expected {
+					t.Errorf("format %d: window %d,%d: expected %v got %v", format, x, y,
+						expected, actual)
+				}
+			}
+		}
+	}
+}
+
+func TestCompiledClassifyAllocs(t *testing.T) {
+	compiled := scanTestCascade().Compile()
+	formats := []IntegralFormat{Float64Integrals, Float32Integrals, Uint32Integrals,
+		Uint64Integrals}
+	for _, format := range formats {
+		img := NewDualImageFormat(scanTestImage(30, 20, 8), format)
+		allocs := testing.AllocsPerRun(100, func() {
+			compiled.Classify(img, 3, 4)
+		})
+		if allocs != 0 {
+			t.Errorf("format %d: expected no allocations but got %f", format, allocs)
+		}
+	}
+}
+
+func TestCompiledScanAllocs(t *testing.T) {
+	// The first layer rejects every window.
+	cascade := scanTestCascade()
+	cascade.Layers[0].Threshold = math.Inf(1)
+	compiled := cascade.Compile()
+
+	// The images have the same levels and rows, but the
+	// wider one has ten times as many windows.
+	narrow := NewDualImage(scanTestImage(40, 20, 8))
+	wide := NewDualImage(scanTestImage(400, 20, 8))
+	scanAllocs := func(img *DualImage) float64 {
+		return testing.AllocsPerRun(10, func() {
+			if len(compiled.Scan(img, 1.1, 1)) != 0 {
+				t.Fatal("unexpected matches")
+			}
+		})
+	}
+	narrowAllocs, wideAllocs := scanAllocs(narrow), scanAllocs(wide)
+	if narrowAllocs != wideAllocs {
+		t.Errorf("expected %f allocations but got %f for more windows", narrowAllocs,
+			wideAllocs)
+	}
+
+	// Each match adds the Match and its LayerSums.
+	compiled = scanTestCascade().Compile()
+	img := NewDualImage(scanTestImage(40, 20, 8))
+	numMatches := len(compiled.Scan(img, 1.1, 1))
+	if numMatches == 0 {
+		t.Fatal("expected some matches")
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		compiled.Scan(img, 1.1, 1)
+	})
+	if max := narrowAllocs + 3*float64(numMatches); allocs > max {
+		t.Errorf("expected at most %f allocations for %d matches but got %f", max,
+			numMatches, allocs)
+	}
+}
+
+func TestCompiledScan(t *testing.T) {
+	cascade := scanTestCascade()
+	compiled := cascade.Compile()
+	for seed := int64(0); seed < 3; seed++ {
+		img := NewDualImage(scanTestImage(70, 50, seed))
+		for _, opts := range []*ScanOptions{{}, {Scale: 1.1, StrideX: 1.5, Workers: 2}} {
+			expected, _ := cascade.ScanWithOptions(context.Background(), img, opts)
+			actual, _ := compiled.ScanWithOptions(context.Background(), img, opts)
+			if len(expected) == 0 || len(actual) != len(expected) {
+				t.Errorf("seed %d: expected %d matches got %d", seed, len(expected),
+					len(actual))
+				continue
+			}
+			for i, x := range expected {
+				a := actual[i]
+				if x.X != a.X || x.Y != a.Y || x.Width != a.Width || x.Height != a.Height ||
+					x.Scale != a.Scale || math.Abs(x.Score-a.Score) > 1e-8 {
+					t.Errorf("seed %d match %d: expected %v got %v", seed, i, x, a)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkCascadeClassify(b *testing.B) {
+	cascade := scanTestCascade()
+	img := NewDualImage(scanTestImage(30, 20, 8))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cascade.Classify(img.Window(3, 4, cascade.WindowWidth, cascade.WindowHeight))
+	}
+}
+
+func BenchmarkCompiledClassify(b *testing.B) {
+	compiled := scanTestCascade().Compile()
+	img := NewDualImage(scanTestImage(30, 20, 8))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		compiled.Classify(img, 3, 4)
+	}
+}
+
+func BenchmarkCompiledScan(b *testing.B) {
+	compiled := scanTestCascade().Compile()
+	img := NewDualImage(scanTestImage(320, 240, 4))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		compiled.Scan(img, 0, 0)
+	}
+}
+
+func TestCompiledTilted(t *testing.T) {
+	cascade := scanTestCascade()
+	layer := cascade.Layers[1]
+	layer.Features = append(layer.Features, &Feature{TiltedHorizontalPair, 4, 1, 4, 2},
+		&Feature{TiltedVerticalTriple, 6, 0, 2, 6})
+	layer.Thresholds = append(layer.Thresholds, 0.5, -1)
+	layer.Weights = append(layer.Weights, 0.3, 0.2)
+	compiled := cascade.Compile()
+
+	img := NewDualImage(scanTestImage(70, 50, 2))
+	for _, opts := range []*ScanOptions{{}, {Scale: 1.1, StrideX: 1.5}} {
+		expected, _ := cascade.ScanWithOptions(context.Background(), img, opts)
+		actual, _ := compiled.ScanWithOptions(context.Background(), img, opts)
+		if len(expected) == 0 || len(actual) != len(expected) {
+			t.Errorf("expected %d matches got %d", len(expected), len(actual))
+			continue
+		}
+		for i, x := range expected {
+			a := actual[i]
+			if x.X != a.X || x.Y != a.Y || x.Width != a.Width || x.Height != a.Height ||
+				math.Abs(x.Score-a.Score) > 1e-8 {
+				t.Errorf("match %d: expected %v got %v", i, x, a)
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+type cocoDataset struct {
+	Images []struct {
+		ID       int64  `json:"id"`
+		FileName string `json:"file_name"`
+	} `json:"images"`
+	Annotations []struct {
+		ImageID    int64      `json:"image_id"`
+		CategoryID int64      `json:"category_id"`
+		BBox       [4]float64 `json:"bbox"`
+		IsCrowd    int        `json:"iscrowd"`
+	} `json:"annotations"`
+	Categories []struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	} `json:"categories"`
+}
+
+// LoadCOCO loads a COCO JSON annotation file.
+// The image files are looked up in imageDir.
+func LoadCOCO(path, imageDir string) ([]*Annotation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	res, err := ParseCOCO(f, imageDir)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return res, nil
+}
+
+// ParseCOCO parses COCO JSON annotations.
+// The image files are looked up in imageDir.
+//
+// Every image is included, even if it has no boxes.
+// Boxes are labeled with the names of their categories,
+// and crowd annotations are marked as difficult.
+func ParseCOCO(r io.Reader, imageDir string) ([]*Annotation, error) {
+	var obj cocoDataset
+	if err := json.NewDecoder(r).Decode(&obj); err != nil {
+		return nil, err
+	}
+
+	categories := map[int64]string{}
+	for _, c := range obj.Categories {
+		categories[c.ID] = c.Name
+	}
+
+	var res []*Annotation
+	images := map[int64]*Annotation{}
+	for _, img := range obj.Images {
+		a := &Annotation{Path: filepath.Join(imageDir, img.FileName)}
+		images[img.ID] = a
+		res = append(res, a)
+	}
+
+	for _, ann := range obj.Annotations {
+		a, ok := images[ann.ImageID]
+		if !ok {
+			return nil, fmt.Errorf("unknown image ID: %d", ann.ImageID)
+		}
+		label, ok := categories[ann.CategoryID]
+		if !ok {
+			return nil, fmt.Errorf("unknown category ID: %d", ann.CategoryID)
+		}
+		x, y, w, h := ann.BBox[0], ann.BBox[1], ann.BBox[2], ann.BBox[3]
+		a.Boxes = append(a.Boxes, Box{
+			Label:     label,
+			Rect:      roundRect(x, y, x+w, y+h),
+			Difficult: ann.IsCrowd != 0,
+		})
+	}
+
+	return res, nil
+}
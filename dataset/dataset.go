@@ -0,0 +1,206 @@
+// Package dataset loads images with labeled boxes from
+// common annotation formats, for training and evaluating
+// cascades.
+package dataset
+
+import (
+	"fmt"
+	"image"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/unixpickle/haar"
+)
+
+// Names of the formats supported by Load.
+const (
+	VOCFormat     = "voc"
+	COCOFormat    = "coco"
+	InfoDatFormat = "infodat"
+	JSONFormat    = "json"
+)
+
+// A Box is a labeled region of an image.
+type Box struct {
+	// Label is the class of the object in the box.
+	// It is empty for formats without labels, such as
+	// info.dat.
+	Label string
+
+	Rect image.Rectangle
+
+	// Difficult is set for boxes which should not count
+	// against a detector, such as "difficult" objects in
+	// Pascal VOC and crowds in COCO.
+	Difficult bool
+}
+
+// An Annotation lists the boxes in an image.
+type Annotation struct {
+	// Path is the path to the image file.
+	Path string
+
+	Boxes []Box
+}
+
+// Rects returns the rectangles of the boxes with the
+// given label which are not difficult.
+// If label is empty, boxes with any label are included.
+func (a *Annotation) Rects(label string) []image.Rectangle {
+	return a.rects(label, false)
+}
+
+// Ignored is like Rects, but it returns the rectangles of
+// the difficult boxes instead.
+func (a *Annotation) Ignored(label string) []image.Rectangle {
+	return a.rects(label, true)
+}
+
+func (a *Annotation) rects(label string, difficult bool) []image.Rectangle {
+	var res []image.Rectangle
+	for _, box := range a.Boxes {
+		if (label == "" || box.Label == label) && box.Difficult == difficult {
+			res = append(res, box.Rect)
+		}
+	}
+	return res
+}
+
+// Image reads the annotated image.
+func (a *Annotation) Image() (*haar.DualImage, error) {
+	return readImage(a.Path)
+}
+
+// Load loads annotations in the given format.
+//
+// For VOCFormat, path is a directory of XML files.
+// For COCOFormat, path is a JSON file.
+// For InfoDatFormat and JSONFormat, path is a list file,
+// and image paths are relative to its directory.
+//
+// If imageDir is empty, the images for VOC annotations
+// are expected in a "JPEGImages" directory next to the
+// annotation directory, and the images for COCO
+// annotations are expected next to the JSON file.
+func Load(format, path, imageDir string) ([]*Annotation, error) {
+	switch format {
+	case VOCFormat:
+		if imageDir == "" {
+			imageDir = filepath.Join(filepath.Dir(filepath.Clean(path)), "JPEGImages")
+		}
+		return LoadVOC(path, imageDir)
+	case COCOFormat:
+		if imageDir == "" {
+			imageDir = filepath.Dir(path)
+		}
+		return LoadCOCO(path, imageDir)
+	case InfoDatFormat:
+		return LoadInfoDat(path)
+	case JSONFormat:
+		return LoadJSON(path)
+	default:
+		return nil, fmt.Errorf("unknown annotation format: %s", format)
+	}
+}
+
+// Positives crops every box with the given label out of
+// the annotated images and scales the croppings to the
+// given size.
+//
+// If label is empty, every box is used.
+// Difficult boxes are skipped, and boxes are clipped to
+// the bounds of their images.
+// Boxes with a different aspect ratio than the samples
+// are stretched.
+func Positives(annotations []*Annotation, label string, width,
+	height int) ([]haar.IntegralImage, error) {
+	var res []haar.IntegralImage
+	for _, a := range annotations {
+		rects := a.Rects(label)
+		if len(rects) == 0 {
+			continue
+		}
+		img, err := a.Image()
+		if err != nil {
+			return nil, err
+		}
+		bounds := image.Rect(0, 0, img.Width(), img.Height())
+		for _, r := range rects {
+			r = r.Intersect(bounds)
+			if r.Empty() {
+				continue
+			}
+			crop := haar.NewDualImage(img.Window(r.Min.X, r.Min.Y, r.Dx(), r.Dy()))
+			if r.Dx() != width || r.Dy() != height {
+				crop = crop.Resize(width, height)
+			}
+			res = append(res, crop.Window(0, 0, width, height))
+		}
+	}
+	return res, nil
+}
+
+// SampleSource creates a haar.SampleSource from
+// annotated images.
+//
+// The positives are created with Positives.
+// The negatives are the annotated images without any
+// boxes with the given label, including difficult ones,
+// along with every image in negativeDir, if it is not
+// empty.
+func SampleSource(annotations []*Annotation, label string, width, height int,
+	negativeDir string) (haar.SampleSource, error) {
+	positives, err := Positives(annotations, label, width, height)
+	if err != nil {
+		return nil, err
+	}
+
+	var negatives []*haar.DualImage
+	for _, a := range annotations {
+		if len(a.Rects(label)) > 0 || len(a.Ignored(label)) > 0 {
+			continue
+		}
+		img, err := a.Image()
+		if err != nil {
+			return nil, err
+		}
+		negatives = append(negatives, img)
+	}
+	if negativeDir != "" {
+		listing, err := ioutil.ReadDir(negativeDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range listing {
+			if item.IsDir() || strings.HasPrefix(item.Name(), ".") {
+				continue
+			}
+			img, err := readImage(filepath.Join(negativeDir, item.Name()))
+			if err != nil {
+				return nil, err
+			}
+			negatives = append(negatives, img)
+		}
+	}
+
+	return haar.NewSampleSource(positives, negatives)
+}
+
+func readImage(path string) (*haar.DualImage, error) {
+	img, err := haar.ReadDualImage(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %s", path, err)
+	}
+	return img, nil
+}
+
+// roundRect creates a rectangle from floating point
+// coordinates, rounding them to the nearest pixel.
+func roundRect(minX, minY, maxX, maxY float64) image.Rectangle {
+	round := func(x float64) int {
+		return int(math.Floor(x + 0.5))
+	}
+	return image.Rect(round(minX), round(minY), round(maxX), round(maxY))
+}
@@ -0,0 +1,249 @@
+package dataset
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseVOC(t *testing.T) {
+	data := `<annotation>
+	<filename>a.jpg</filename>
+	<object>
+		<name>face</name>
+		<difficult>0</difficult>
+		<bndbox><xmin>1</xmin><ymin>11</ymin><xmax>10</xmax><ymax>30</ymax></bndbox>
+	</object>
+	<object>
+		<name>car</name>
+		<difficult>1</difficult>
+		<bndbox><xmin>5.5</xmin><ymin>6</ymin><xmax>20</xmax><ymax>20</ymax></bndbox>
+	</object>
+</annotation>`
+	a, err := ParseVOC(strings.NewReader(data), "images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Path != filepath.Join("images", "a.jpg") {
+		t.Errorf("unexpected path %s", a.Path)
+	}
+	expected := []Box{
+		{Label: "face", Rect: image.Rect(0, 10, 10, 30)},
+		{Label: "car", Rect: image.Rect(5, 5, 20, 20), Difficult: true},
+	}
+	if !boxesEqual(a.Boxes, expected) {
+		t.Errorf("expected %v got %v", expected, a.Boxes)
+	}
+
+	if _, err := ParseVOC(strings.NewReader("<annotation></annotation>"), ""); err == nil {
+		t.Error("expected error for missing filename")
+	}
+}
+
+func TestParseCOCO(t *testing.T) {
+	data := `{
+		"images": [{"id": 1, "file_name": "a.jpg"}, {"id": 2, "file_name": "b.jpg"}],
+		"categories": [{"id": 3, "name": "face"}, {"id": 4, "name": "person"}],
+		"annotations": [
+			{"image_id": 1, "category_id": 3, "bbox": [1.2, 2, 10, 20.6], "iscrowd": 0},
+			{"image_id": 1, "category_id": 4, "bbox": [0, 0, 5, 5], "iscrowd": 1}
+		]
+	}`
+	anns, err := ParseCOCO(strings.NewReader(data), "images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anns) != 2 {
+		t.Fatalf("expected 2 annotations got %d", len(anns))
+	}
+	if anns[0].Path != filepath.Join("images", "a.jpg") ||
+		anns[1].Path != filepath.Join("images", "b.jpg") {
+		t.Errorf("unexpected paths %s, %s", anns[0].Path, anns[1].Path)
+	}
+	expected := []Box{
+		{Label: "face", Rect: image.Rect(1, 2, 11, 23)},
+		{Label: "person", Rect: image.Rect(0, 0, 5, 5), Difficult: true},
+	}
+	if !boxesEqual(anns[0].Boxes, expected) {
+		t.Errorf("expected %v got %v", expected, anns[0].Boxes)
+	}
+	if len(anns[1].Boxes) != 0 {
+		t.Errorf("unexpected boxes %v", anns[1].Boxes)
+	}
+
+	for _, bad := range []string{
+		`{"images": [], "annotations": [{"image_id": 1, "category_id": 1}]}`,
+		`{"images": [{"id": 1}], "annotations": [{"image_id": 1, "category_id": 1}]}`,
+	} {
+		if _, err := ParseCOCO(strings.NewReader(bad), ""); err == nil {
+			t.Errorf("expected error for %s", bad)
+		}
+	}
+}
+
+func TestParseInfoDat(t *testing.T) {
+	data := "pos/a.png 2 1 2 3 4 10 10 5 5\n\npos/b.png 0\n/abs/c.png 1 0 0 1 1\n"
+	anns, err := ParseInfoDat(strings.NewReader(data), "base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anns) != 3 {
+		t.Fatalf("expected 3 annotations got %d", len(anns))
+	}
+	if anns[0].Path != filepath.Join("base", "pos", "a.png") || anns[2].Path != "/abs/c.png" {
+		t.Errorf("unexpected paths %s, %s", anns[0].Path, anns[2].Path)
+	}
+	expected := []Box{
+		{Rect: image.Rect(1, 2, 4, 6)},
+		{Rect: image.Rect(10, 10, 15, 15)},
+	}
+	if !boxesEqual(anns[0].Boxes, expected) {
+		t.Errorf("expected %v got %v", expected, anns[0].Boxes)
+	}
+	if len(anns[1].Boxes) != 0 {
+		t.Errorf("unexpected boxes %v", anns[1].Boxes)
+	}
+
+	for _, bad := range []string{
+		"a.png",
+		"a.png x",
+		"a.png 1 1 2 3",
+		"a.png 1 1 2 3 z",
+	} {
+		_, err := ParseInfoDat(strings.NewReader("b.png 0\n"+bad), "")
+		if err == nil {
+			t.Errorf("expected error for %q", bad)
+		} else if !strings.HasPrefix(err.Error(), "line 2:") {
+			t.Errorf("unexpected error %s", err)
+		}
+	}
+}
+
+func TestAnnotationRects(t *testing.T) {
+	a := &Annotation{
+		Boxes: []Box{
+			{Label: "face", Rect: image.Rect(0, 0, 1, 1)},
+			{Label: "car", Rect: image.Rect(1, 1, 2, 2)},
+			{Label: "car", Rect: image.Rect(2, 2, 3, 3), Difficult: true},
+		},
+	}
+	if r := a.Rects(""); len(r) != 2 {
+		t.Errorf("unexpected rects %v", r)
+	}
+	if r := a.Ignored("car"); len(r) != 1 || r[0] != image.Rect(2, 2, 3, 3) {
+		t.Errorf("unexpected ignored rects %v", r)
+	}
+	if r := a.Ignored("face"); len(r) != 0 {
+		t.Errorf("unexpected ignored rects %v", r)
+	}
+	if r := a.Rects("car"); len(r) != 1 || r[0] != image.Rect(1, 1, 2, 2) {
+		t.Errorf("unexpected rects %v", r)
+	}
+	if r := a.Rects("dog"); len(r) != 0 {
+		t.Errorf("unexpected rects %v", r)
+	}
+}
+
+func TestSampleSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dataset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestImage(t, filepath.Join(dir, "a.png"), 40, 30)
+	writeTestImage(t, filepath.Join(dir, "b.png"), 20, 20)
+	negDir := filepath.Join(dir, "neg")
+	if err := os.Mkdir(negDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestImage(t, filepath.Join(negDir, "c.png"), 16, 16)
+
+	listing := `[
+		{"Image": "a.png", "Boxes": [
+			{"Label": "face", "X": 0, "Y": 0, "Width": 20, "Height": 20},
+			{"Label": "face", "X": 30, "Y": 20, "Width": 20, "Height": 20},
+			{"Label": "face", "X": 5, "Y": 5, "Width": 8, "Height": 8, "Difficult": true}
+		]},
+		{"Image": "b.png", "Boxes": [{"Label": "car", "X": 0, "Y": 0, "Width": 5, "Height": 5}]}
+	]`
+	listPath := filepath.Join(dir, "list.json")
+	if err := ioutil.WriteFile(listPath, []byte(listing), 0644); err != nil {
+		t.Fatal(err)
+	}
+	anns, err := Load(JSONFormat, listPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anns) != 2 || anns[0].Path != filepath.Join(dir, "a.png") {
+		t.Fatalf("unexpected annotations %v", anns)
+	}
+
+	samples, err := SampleSource(anns, "face", 10, 12, negDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	positives := samples.Positives()
+	if len(positives) != 2 {
+		t.Fatalf("expected 2 positives got %d", len(positives))
+	}
+	for _, pos := range positives {
+		if pos.Width() != 10 || pos.Height() != 12 {
+			t.Errorf("unexpected positive size %dx%d", pos.Width(), pos.Height())
+		}
+	}
+	if n := len(samples.InitialNegatives()); n == 0 {
+		t.Error("expected negatives")
+	}
+
+	// An image with only difficult boxes is not a negative.
+	difficult := &Annotation{
+		Path:  anns[1].Path,
+		Boxes: []Box{{Label: "face", Rect: image.Rect(0, 0, 5, 5), Difficult: true}},
+	}
+	_, err = SampleSource([]*Annotation{anns[0], difficult}, "face", 10, 12, "")
+	if err == nil {
+		t.Error("expected error without negatives")
+	}
+
+	if _, err := SampleSource(anns, "dog", 10, 12, ""); err == nil {
+		t.Error("expected error without positives")
+	}
+	if _, err := Load("unknown", listPath, ""); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func writeTestImage(t *testing.T, path string, width, height int) {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8((x*7 + y*13) % 256)})
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func boxesEqual(b1, b2 []Box) bool {
+	if len(b1) != len(b2) {
+		return false
+	}
+	for i, b := range b1 {
+		if b != b2[i] {
+			return false
+		}
+	}
+	return true
+}
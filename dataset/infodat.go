@@ -0,0 +1,82 @@
+package dataset
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LoadInfoDat loads an OpenCV info.dat file, as used by
+// opencv_createsamples and opencv_traincascade.
+// Image paths are relative to the file's directory.
+func LoadInfoDat(path string) ([]*Annotation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	res, err := ParseInfoDat(f, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return res, nil
+}
+
+// ParseInfoDat parses an OpenCV info.dat file.
+// Image paths are relative to baseDir.
+//
+// Each line contains an image path, the number of
+// objects, and then the x, y, width, and height of each
+// object, all separated by whitespace.
+// Blank lines are ignored.
+// The boxes have no labels.
+func ParseInfoDat(r io.Reader, baseDir string) ([]*Annotation, error) {
+	var res []*Annotation
+	scanner := bufio.NewScanner(r)
+	var lineNum int
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: missing object count", lineNum)
+		}
+		count, err := strconv.Atoi(fields[1])
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("line %d: invalid object count: %s", lineNum, fields[1])
+		}
+		if len(fields) != 2+count*4 {
+			return nil, fmt.Errorf("line %d: expected %d objects", lineNum, count)
+		}
+		path := fields[0]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		a := &Annotation{Path: path}
+		for i := 0; i < count; i++ {
+			var nums [4]int
+			for j := range nums {
+				field := fields[2+i*4+j]
+				nums[j], err = strconv.Atoi(field)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid number: %s", lineNum, field)
+				}
+			}
+			a.Boxes = append(a.Boxes, Box{
+				Rect: image.Rect(nums[0], nums[1], nums[0]+nums[2], nums[1]+nums[3]),
+			})
+		}
+		res = append(res, a)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
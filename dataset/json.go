@@ -0,0 +1,58 @@
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"path/filepath"
+)
+
+type jsonAnnotation struct {
+	Image string
+	Boxes []struct {
+		Label     string
+		X         int
+		Y         int
+		Width     int
+		Height    int
+		Difficult bool
+	}
+}
+
+// LoadJSON loads a simple JSON list of annotations.
+// Image paths are relative to the file's directory.
+//
+// The file is a JSON array of objects like
+//
+//	{"Image": "a.png", "Boxes": [{"X": 1, "Y": 2, "Width": 3, "Height": 4}]}
+//
+// where each box may also have a "Label" and a
+// "Difficult" flag.
+func LoadJSON(path string) ([]*Annotation, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var objs []*jsonAnnotation
+	if err := json.Unmarshal(data, &objs); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	baseDir := filepath.Dir(path)
+	res := make([]*Annotation, len(objs))
+	for i, obj := range objs {
+		a := &Annotation{Path: obj.Image}
+		if !filepath.IsAbs(a.Path) {
+			a.Path = filepath.Join(baseDir, a.Path)
+		}
+		for _, box := range obj.Boxes {
+			a.Boxes = append(a.Boxes, Box{
+				Label:     box.Label,
+				Rect:      image.Rect(box.X, box.Y, box.X+box.Width, box.Y+box.Height),
+				Difficult: box.Difficult,
+			})
+		}
+		res[i] = a
+	}
+	return res, nil
+}
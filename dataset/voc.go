@@ -0,0 +1,76 @@
+package dataset
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type vocAnnotation struct {
+	Filename string `xml:"filename"`
+	Objects  []struct {
+		Name      string `xml:"name"`
+		Difficult int    `xml:"difficult"`
+		Box       struct {
+			XMin float64 `xml:"xmin"`
+			YMin float64 `xml:"ymin"`
+			XMax float64 `xml:"xmax"`
+			YMax float64 `xml:"ymax"`
+		} `xml:"bndbox"`
+	} `xml:"object"`
+}
+
+// LoadVOC loads every Pascal VOC XML file in a directory.
+// The image files are looked up in imageDir.
+func LoadVOC(annotationDir, imageDir string) ([]*Annotation, error) {
+	listing, err := ioutil.ReadDir(annotationDir)
+	if err != nil {
+		return nil, err
+	}
+	var res []*Annotation
+	for _, item := range listing {
+		if item.IsDir() || !strings.HasSuffix(strings.ToLower(item.Name()), ".xml") {
+			continue
+		}
+		path := filepath.Join(annotationDir, item.Name())
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		a, err := ParseVOC(f, imageDir)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		res = append(res, a)
+	}
+	return res, nil
+}
+
+// ParseVOC parses a Pascal VOC XML annotation.
+// The image file is looked up in imageDir.
+//
+// VOC boxes use 1-based, inclusive pixel coordinates,
+// which are converted to 0-based rectangles.
+func ParseVOC(r io.Reader, imageDir string) (*Annotation, error) {
+	var obj vocAnnotation
+	if err := xml.NewDecoder(r).Decode(&obj); err != nil {
+		return nil, err
+	}
+	if obj.Filename == "" {
+		return nil, fmt.Errorf("missing filename")
+	}
+	res := &Annotation{Path: filepath.Join(imageDir, obj.Filename)}
+	for _, o := range obj.Objects {
+		res.Boxes = append(res.Boxes, Box{
+			Label:     o.Name,
+			Rect:      roundRect(o.Box.XMin-1, o.Box.YMin-1, o.Box.XMax, o.Box.YMax),
+			Difficult: o.Difficult != 0,
+		})
+	}
+	return res, nil
+}
@@ -2,7 +2,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
@@ -19,12 +21,47 @@ import (
 const OverlapThreshold = 0.7
 
 func main() {
-	if len(os.Args) != 4 {
-		fmt.Fprintf(os.Stderr, "Usage: %s cascade.json input.png output.png\n", os.Args[0])
+	mirror := flag.Bool("mirror", false, "also detect mirror images of objects")
+	maxAngle := flag.Float64("max-angle", 0, "maximum in-plane rotation to detect, in degrees")
+	angleStep := flag.Float64("angle-step", 10, "step between detected rotations, in degrees")
+	minNeighbors := flag.Int("min-neighbors", 0,
+		"group matches like OpenCV with this many neighbors (0 to join overlaps)")
+	groupEps := flag.Float64("group-eps", haar.DefaultGroupEpsilon,
+		"similarity epsilon for -min-neighbors")
+	merge := flag.String("merge", "join",
+		"how to merge overlapping matches (join, weighted, or nms)")
+	useIoU := flag.Bool("iou", false, "measure overlap as intersection over union")
+	threshold := flag.Float64("overlap", OverlapThreshold, "overlap threshold for merging")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] cascade.json input.png output.png\n",
+			os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 3 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *maxAngle < 0 || *angleStep <= 0 {
+		fmt.Fprintln(os.Stderr, "Invalid angle range.")
+		os.Exit(1)
+	}
+	if *maxAngle > 0 && *mirror {
+		fmt.Fprintln(os.Stderr, "Cannot detect mirror images and rotations together.")
+		os.Exit(1)
+	}
+	if *merge != "join" && *merge != "weighted" && *merge != "nms" {
+		fmt.Fprintln(os.Stderr, "Invalid merge strategy:", *merge)
 		os.Exit(1)
 	}
+	metric := haar.SmallerAreaOverlap
+	if *useIoU {
+		metric = haar.IoUOverlap
+	}
 
-	cascadeData, err := ioutil.ReadFile(os.Args[1])
+	cascadeData, err := ioutil.ReadFile(args[0])
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Failed to read cascade:", err)
 		os.Exit(1)
@@ -35,7 +72,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	f, err := os.Open(os.Args[2])
+	f, err := os.Open(args[1])
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Failed to open image file:", err)
 		os.Exit(1)
@@ -48,10 +85,26 @@ func main() {
 	}
 
 	intImg := haar.ImageIntegralImage(img)
-	matches := cascade.Scan(haar.NewDualImage(intImg), 0, 0)
-	matches = matches.JoinOverlaps(OverlapThreshold)
+	var matches haar.Matches
+	if *maxAngle > 0 {
+		matches, _ = cascade.ScanRotated(context.Background(), haar.NewDualImage(intImg),
+			Angles(*maxAngle, *angleStep), nil)
+	} else if *mirror {
+		matches, _ = cascade.ScanMirrored(context.Background(), haar.NewDualImage(intImg), nil)
+	} else {
+		matches = cascade.Scan(haar.NewDualImage(intImg), 0, 0)
+	}
+	if *minNeighbors > 0 {
+		matches = matches.GroupRectangles(*minNeighbors, *groupEps)
+	} else if *merge == "weighted" {
+		matches = matches.WeightedJoinOverlaps(*threshold, metric)
+	} else if *merge == "nms" {
+		matches = matches.NonMaxSuppression(*threshold, metric)
+	} else {
+		matches = matches.JoinOverlapsMetric(*threshold, metric)
+	}
 
-	output, err := os.Create(os.Args[3])
+	output, err := os.Create(args[2])
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Failed to create output file:", err)
 		os.Exit(1)
@@ -65,19 +118,35 @@ func main() {
 	}
 }
 
+// Angles returns the angles, in radians, from -maxAngle
+// to maxAngle degrees in steps of angleStep degrees.
+func Angles(maxAngle, angleStep float64) []float64 {
+	res := []float64{0}
+	for angle := angleStep; angle <= maxAngle+1e-8; angle += angleStep {
+		radians := angle * math.Pi / 180
+		res = append(res, -radians, radians)
+	}
+	return res
+}
+
 func AnnotateImage(img image.Image, matches haar.Matches) image.Image {
 	dest := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
 	ctx := draw2dimg.NewGraphicContext(dest)
 
 	ctx.DrawImage(img)
-	ctx.SetStrokeColor(color.RGBA{R: 0xff, A: 0xff})
 	ctx.SetLineWidth(math.Max(1, float64(img.Bounds().Dx())/500))
 	for _, match := range matches {
+		if match.Mirrored {
+			ctx.SetStrokeColor(color.RGBA{B: 0xff, A: 0xff})
+		} else {
+			ctx.SetStrokeColor(color.RGBA{R: 0xff, A: 0xff})
+		}
+		corners := match.Corners()
 		ctx.BeginPath()
-		ctx.MoveTo(float64(match.X), float64(match.Y))
-		ctx.LineTo(float64(match.X+match.Width), float64(match.Y))
-		ctx.LineTo(float64(match.X+match.Width), float64(match.Y+match.Height))
-		ctx.LineTo(float64(match.X), float64(match.Y+match.Height))
+		ctx.MoveTo(corners[0][0], corners[0][1])
+		for _, corner := range corners[1:] {
+			ctx.LineTo(corner[0], corner[1])
+		}
 		ctx.Close()
 		ctx.Stroke()
 	}
@@ -0,0 +1,320 @@
+// Package eval measures the accuracy of a cascade on
+// images with ground-truth boxes.
+package eval
+
+import (
+	"context"
+	"image"
+	"math"
+	"sort"
+
+	"github.com/unixpickle/haar"
+)
+
+// Default options used by NewEvaluator.
+const (
+	DefaultIoUThreshold     = 0.5
+	DefaultOverlapThreshold = 0.7
+)
+
+// Options configures an Evaluator.
+type Options struct {
+	// IoUThreshold is the minimum intersection over union
+	// for a detection to match a ground-truth box.
+	// If it is 0, DefaultIoUThreshold is used.
+	IoUThreshold float64
+
+	// Merge merges the raw matches from a scan.
+	// If it is nil, JoinOverlaps is used with
+	// DefaultOverlapThreshold.
+	Merge func(haar.Matches) haar.Matches
+
+	// ScanOptions is passed to ScanWithOptions.
+	ScanOptions *haar.ScanOptions
+
+	// MinOffset is the lowest offset to the final layer's
+	// threshold that can be passed to Curve.
+	// It must not be positive.
+	// Lower values let the curve cover more detections,
+	// at the cost of slower scans.
+	MinOffset float64
+}
+
+// A Result summarizes the accuracy of a cascade at one
+// operating point.
+type Result struct {
+	// Offset is the amount added to the threshold of the
+	// cascade's final layer.
+	Offset float64
+
+	Images int
+	Truths int
+
+	// Detections does not include detections of ignored
+	// boxes (see Evaluator.AddImage).
+	Detections     int
+	TruePositives  int
+	FalsePositives int
+	FalseNegatives int
+
+	Precision              float64
+	Recall                 float64
+	FalsePositivesPerImage float64
+}
+
+// An Evaluator accumulates detections for a set of
+// images and computes statistics from them.
+//
+// Each image is only scanned once, so that the final
+// layer's threshold can be swept without scanning again.
+type Evaluator struct {
+	opts Options
+
+	// lowered is the cascade with its final threshold
+	// lowered by -opts.MinOffset.
+	lowered *haar.Cascade
+
+	images []*imageResult
+}
+
+type imageResult struct {
+	// raw contains the raw matches, with scores relative
+	// to the original final threshold.
+	raw    haar.Matches
+	truth  []*haar.Match
+	ignore []*haar.Match
+}
+
+// NewEvaluator creates an Evaluator for a cascade.
+//
+// If opts is nil, default options are used.
+func NewEvaluator(cascade *haar.Cascade, opts *Options) *Evaluator {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.MinOffset > 0 {
+		panic("MinOffset must not be positive")
+	}
+	if o.IoUThreshold == 0 {
+		o.IoUThreshold = DefaultIoUThreshold
+	}
+	if o.Merge == nil {
+		o.Merge = func(m haar.Matches) haar.Matches {
+			return m.JoinOverlaps(DefaultOverlapThreshold)
+		}
+	}
+
+	lowered := cascade
+	if o.MinOffset != 0 && len(cascade.Layers) > 0 {
+		copied := *cascade
+		copied.Layers = append([]*haar.Layer{}, cascade.Layers...)
+		last := len(copied.Layers) - 1
+		layer := *copied.Layers[last]
+		layer.Threshold += o.MinOffset
+		copied.Layers[last] = &layer
+		lowered = &copied
+	}
+
+	return &Evaluator{opts: o, lowered: lowered}
+}
+
+// AddImage scans an image and records its detections,
+// given the image's ground-truth boxes.
+//
+// The ignore boxes are objects which the cascade need
+// not find, such as difficult or crowded objects.
+// Detections which match an ignore box, and no box in
+// truth, count as neither true nor false positives.
+//
+// If the context is cancelled, the image is not recorded
+// and the context's error is returned.
+func (e *Evaluator) AddImage(ctx context.Context, img *haar.DualImage,
+	truth, ignore []image.Rectangle) error {
+	raw, err := e.lowered.ScanWithOptions(ctx, img, e.opts.ScanOptions)
+	if err != nil {
+		return err
+	}
+	for _, match := range raw {
+		match.Score += e.opts.MinOffset
+	}
+	e.addMatches(raw, truth, ignore)
+	return nil
+}
+
+func (e *Evaluator) addMatches(raw haar.Matches, truth, ignore []image.Rectangle) {
+	res := &imageResult{raw: raw}
+	for _, r := range truth {
+		res.truth = append(res.truth, haar.MatchFromRect(r))
+	}
+	for _, r := range ignore {
+		res.ignore = append(res.ignore, haar.MatchFromRect(r))
+	}
+	e.images = append(e.images, res)
+}
+
+// Result computes statistics for the cascade as it is.
+func (e *Evaluator) Result() *Result {
+	res, _ := e.result(0)
+	return res
+}
+
+// Curve computes results for each of the offsets to the
+// final layer's threshold, for example to plot an ROC
+// curve.
+//
+// Offsets below Options.MinOffset are not allowed, since
+// the scans did not record the matches they would need.
+func (e *Evaluator) Curve(offsets []float64) []*Result {
+	res := make([]*Result, len(offsets))
+	for i, offset := range offsets {
+		if offset < e.opts.MinOffset {
+			panic("offset is below MinOffset")
+		}
+		res[i], _ = e.result(offset)
+	}
+	return res
+}
+
+// AveragePrecision computes the area under the
+// precision-recall curve, ranking detections by score.
+//
+// The detections are those found with the final layer's
+// threshold lowered by Options.MinOffset, so a lower
+// MinOffset lets the curve reach higher recall.
+// Precision is interpolated like in the PASCAL VOC
+// challenge, by taking the best precision at each recall
+// or higher.
+func (e *Evaluator) AveragePrecision() float64 {
+	res, detections := e.result(e.opts.MinOffset)
+	if res.Truths == 0 {
+		return 0
+	}
+	sort.SliceStable(detections, func(i, j int) bool {
+		return detections[i].score > detections[j].score
+	})
+
+	precisions := make([]float64, len(detections))
+	recalls := make([]float64, len(detections))
+	var truePositives int
+	for i, d := range detections {
+		if d.truePositive {
+			truePositives++
+		}
+		precisions[i] = float64(truePositives) / float64(i+1)
+		recalls[i] = float64(truePositives) / float64(res.Truths)
+	}
+	for i := len(precisions) - 2; i >= 0; i-- {
+		precisions[i] = math.Max(precisions[i], precisions[i+1])
+	}
+
+	var ap, lastRecall float64
+	for i, recall := range recalls {
+		ap += (recall - lastRecall) * precisions[i]
+		lastRecall = recall
+	}
+	return ap
+}
+
+type detection struct {
+	score        float64
+	truePositive bool
+}
+
+// result computes statistics for a threshold offset,
+// along with every detection.
+func (e *Evaluator) result(offset float64) (*Result, []detection) {
+	res := &Result{Offset: offset, Images: len(e.images)}
+	var detections []detection
+	for _, img := range e.images {
+		var raw haar.Matches
+		for _, match := range img.raw {
+			if match.Score > offset {
+				m := *match
+				m.Score -= offset
+				raw = append(raw, &m)
+			}
+		}
+		var merged haar.Matches
+		if len(raw) > 0 {
+			merged = e.opts.Merge(raw)
+		}
+		matched := matchTruth(merged, img.truth, e.opts.IoUThreshold)
+		for i, match := range merged {
+			if !matched[i] && matchesAny(match, img.ignore, e.opts.IoUThreshold) {
+				continue
+			}
+			res.Detections++
+			detections = append(detections, detection{
+				score:        match.Score + offset,
+				truePositive: matched[i],
+			})
+			if matched[i] {
+				res.TruePositives++
+			} else {
+				res.FalsePositives++
+			}
+		}
+		res.Truths += len(img.truth)
+	}
+
+	res.FalseNegatives = res.Truths - res.TruePositives
+	if res.Detections > 0 {
+		res.Precision = float64(res.TruePositives) / float64(res.Detections)
+	}
+	if res.Truths > 0 {
+		res.Recall = float64(res.TruePositives) / float64(res.Truths)
+	}
+	if res.Images > 0 {
+		res.FalsePositivesPerImage = float64(res.FalsePositives) / float64(res.Images)
+	}
+	return res, detections
+}
+
+// matchTruth greedily matches detections to ground-truth
+// boxes, from the highest scoring detection to the
+// lowest.
+// Each detection is matched to the unmatched box with
+// which it has the highest IoU, if it is at least
+// threshold.
+// The result indicates which detections were matched.
+func matchTruth(detections haar.Matches, truth []*haar.Match, threshold float64) []bool {
+	order := make([]int, len(detections))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return detections[order[i]].Score > detections[order[j]].Score
+	})
+
+	res := make([]bool, len(detections))
+	used := make([]bool, len(truth))
+	for _, i := range order {
+		best := -1
+		bestIoU := threshold
+		for j, box := range truth {
+			if used[j] {
+				continue
+			}
+			if iou := detections[i].IoU(box); iou >= bestIoU {
+				best, bestIoU = j, iou
+			}
+		}
+		if best >= 0 {
+			used[best] = true
+			res[i] = true
+		}
+	}
+	return res
+}
+
+// matchesAny checks if a detection has at least the
+// threshold IoU with any of the boxes.
+func matchesAny(detection *haar.Match, boxes []*haar.Match, threshold float64) bool {
+	for _, box := range boxes {
+		if detection.IoU(box) >= threshold {
+			return true
+		}
+	}
+	return false
+}
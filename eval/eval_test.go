@@ -0,0 +1,170 @@
+package eval
+
+import (
+	"context"
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/haar"
+)
+
+func TestEvaluator(t *testing.T) {
+	e := NewEvaluator(&haar.Cascade{}, nil)
+	e.addMatches(haar.Matches{
+		{X: 0, Y: 0, Width: 10, Height: 10, Score: 2},
+		{X: 1, Y: 0, Width: 10, Height: 10, Score: 1.5},
+		{X: 100, Y: 100, Width: 10, Height: 10, Score: 0.5},
+	}, []image.Rectangle{image.Rect(0, 0, 10, 10), image.Rect(50, 50, 60, 60)}, nil)
+	e.addMatches(haar.Matches{
+		{X: 5, Y: 5, Width: 10, Height: 10, Score: 0.2},
+	}, nil, nil)
+
+	res := e.Result()
+	expected := Result{
+		Images:                 2,
+		Truths:                 2,
+		Detections:             3,
+		TruePositives:          1,
+		FalsePositives:         2,
+		FalseNegatives:         1,
+		Precision:              1.0 / 3,
+		Recall:                 0.5,
+		FalsePositivesPerImage: 1,
+	}
+	if !resultsEqual(res, &expected) {
+		t.Errorf("expected %+v got %+v", expected, *res)
+	}
+
+	curve := e.Curve([]float64{0, 1, 3})
+	if !resultsEqual(curve[0], &expected) {
+		t.Errorf("expected %+v got %+v", expected, *curve[0])
+	}
+	expected = Result{
+		Offset:         1,
+		Images:         2,
+		Truths:         2,
+		Detections:     1,
+		TruePositives:  1,
+		FalseNegatives: 1,
+		Precision:      1,
+		Recall:         0.5,
+	}
+	if !resultsEqual(curve[1], &expected) {
+		t.Errorf("expected %+v got %+v", expected, *curve[1])
+	}
+	if curve[2].Detections != 0 || curve[2].Precision != 0 {
+		t.Errorf("unexpected result %+v", *curve[2])
+	}
+
+	if ap := e.AveragePrecision(); math.Abs(ap-0.5) > 1e-8 {
+		t.Errorf("expected average precision 0.5 got %f", ap)
+	}
+}
+
+func TestEvaluatorIgnore(t *testing.T) {
+	e := NewEvaluator(&haar.Cascade{}, nil)
+	e.addMatches(haar.Matches{
+		{X: 0, Y: 0, Width: 10, Height: 10, Score: 2},
+		{X: 1, Y: 0, Width: 10, Height: 10, Score: 1.5},
+		{X: 50, Y: 50, Width: 10, Height: 10, Score: 1},
+		{X: 51, Y: 50, Width: 10, Height: 10, Score: 0.8},
+		{X: 100, Y: 100, Width: 10, Height: 10, Score: 0.5},
+	}, []image.Rectangle{image.Rect(0, 0, 10, 10)},
+		[]image.Rectangle{image.Rect(0, 0, 10, 10), image.Rect(50, 50, 60, 60)})
+
+	// The ignore boxes absorb every detection except the
+	// true positive and the one at (100, 100).
+	res := e.Result()
+	expected := Result{
+		Images:                 1,
+		Truths:                 1,
+		Detections:             2,
+		TruePositives:          1,
+		FalsePositives:         1,
+		Precision:              0.5,
+		Recall:                 1,
+		FalsePositivesPerImage: 1,
+	}
+	if !resultsEqual(res, &expected) {
+		t.Errorf("expected %+v got %+v", expected, *res)
+	}
+	if ap := e.AveragePrecision(); math.Abs(ap-1) > 1e-8 {
+		t.Errorf("expected average precision 1 got %f", ap)
+	}
+}
+
+func TestMatchTruth(t *testing.T) {
+	detections := haar.Matches{
+		{X: 2, Y: 0, Width: 10, Height: 10, Score: 1},
+		{X: 0, Y: 0, Width: 10, Height: 10, Score: 2},
+		{X: 30, Y: 0, Width: 10, Height: 10, Score: 3},
+	}
+	truth := []*haar.Match{
+		haar.MatchFromRect(image.Rect(0, 0, 10, 10)),
+		haar.MatchFromRect(image.Rect(3, 0, 13, 10)),
+	}
+	matched := matchTruth(detections, truth, 0.5)
+	if !matched[0] || !matched[1] || matched[2] {
+		t.Errorf("unexpected matches %v", matched)
+	}
+
+	// Without the second box, the higher scoring detection
+	// takes the first box.
+	matched = matchTruth(detections, truth[:1], 0.5)
+	if matched[0] || !matched[1] || matched[2] {
+		t.Errorf("unexpected matches %v", matched)
+	}
+}
+
+func TestEvaluatorAddImage(t *testing.T) {
+	feature := &haar.Feature{Type: haar.HorizontalPair, Width: 4, Height: 4}
+	cascade := &haar.Cascade{
+		WindowWidth:  4,
+		WindowHeight: 4,
+		Layers: []*haar.Layer{
+			{
+				Features:   []haar.WindowFeature{feature},
+				Thresholds: []float64{math.Inf(-1)},
+				Weights:    []float64{1},
+				Threshold:  0,
+			},
+		},
+	}
+	pixels := make([]float64, 8*8)
+	for i := range pixels {
+		pixels[i] = rand.Float64()
+	}
+	img := haar.NewDualImage(haar.BitmapIntegralImage(pixels, 8, 8))
+
+	e := NewEvaluator(cascade, &Options{
+		MinOffset:   -0.5,
+		ScanOptions: &haar.ScanOptions{MaxSize: image.Pt(4, 4)},
+	})
+	if err := e.AddImage(context.Background(), img, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.images[0].raw) != 25 {
+		t.Fatalf("expected 25 raw matches got %d", len(e.images[0].raw))
+	}
+	for _, match := range e.images[0].raw {
+		if math.Abs(match.Score-1) > 1e-8 {
+			t.Fatalf("unexpected score %f", match.Score)
+		}
+	}
+	if cascade.Layers[0].Threshold != 0 {
+		t.Error("cascade was modified")
+	}
+	if res := e.Result(); res.Detections == 0 || res.FalsePositives != res.Detections {
+		t.Errorf("unexpected result %+v", *res)
+	}
+}
+
+func resultsEqual(r1, r2 *Result) bool {
+	return r1.Offset == r2.Offset && r1.Images == r2.Images && r1.Truths == r2.Truths &&
+		r1.Detections == r2.Detections && r1.TruePositives == r2.TruePositives &&
+		r1.FalsePositives == r2.FalsePositives && r1.FalseNegatives == r2.FalseNegatives &&
+		math.Abs(r1.Precision-r2.Precision) < 1e-8 && math.Abs(r1.Recall-r2.Recall) < 1e-8 &&
+		math.Abs(r1.FalsePositivesPerImage-r2.FalsePositivesPerImage) < 1e-8
+}
@@ -0,0 +1,182 @@
+// Command evaluate measures the accuracy of a cascade on
+// images with ground-truth boxes.
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/unixpickle/haar"
+	"github.com/unixpickle/haar/dataset"
+	"github.com/unixpickle/haar/eval"
+)
+
+func main() {
+	var opts eval.Options
+	format := flag.String("format", dataset.JSONFormat,
+		"annotation format (json, voc, coco, or infodat)")
+	imageDir := flag.String("images", "", "image directory for VOC or COCO annotations")
+	label := flag.String("label", "", "only evaluate boxes with this label")
+	flag.Float64Var(&opts.IoUThreshold, "iou", eval.DefaultIoUThreshold,
+		"minimum IoU for a detection to match a box")
+	merge := flag.String("merge", "join",
+		"how to merge overlapping matches (join, weighted, or nms)")
+	overlap := flag.Float64("overlap", eval.DefaultOverlapThreshold,
+		"overlap threshold for merging")
+	useIoU := flag.Bool("merge-iou", false, "measure overlap as IoU when merging")
+	minNeighbors := flag.Int("min-neighbors", 0,
+		"group matches like OpenCV with this many neighbors (overrides -merge)")
+	curvePath := flag.String("curve", "", "output file for a threshold sweep (.csv or .json)")
+	sweepMin := flag.Float64("sweep-min", -1,
+		"lowest final threshold offset to sweep and to rank detections for average precision")
+	sweepMax := flag.Float64("sweep-max", 1, "highest final threshold offset to sweep")
+	sweepSteps := flag.Int("sweep-steps", 20, "number of steps in the sweep")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] cascade.json annotations\n\n",
+			os.Args[0])
+		fmt.Fprintln(os.Stderr, "The json format is an array of objects like")
+		fmt.Fprintln(os.Stderr, `{"Image": "a.png", "Boxes": [{"X": 1, "Y": 2, "Width": 3,`+
+			` "Height": 4}]}`)
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *sweepMin > 0 || *sweepMax < *sweepMin || *sweepSteps < 1 {
+		fmt.Fprintln(os.Stderr, "Invalid sweep range.")
+		os.Exit(1)
+	}
+
+	metric := haar.SmallerAreaOverlap
+	if *useIoU {
+		metric = haar.IoUOverlap
+	}
+	switch {
+	case *minNeighbors > 0:
+		opts.Merge = func(m haar.Matches) haar.Matches {
+			return m.GroupRectangles(*minNeighbors, haar.DefaultGroupEpsilon)
+		}
+	case *merge == "join":
+		opts.Merge = func(m haar.Matches) haar.Matches {
+			return m.JoinOverlapsMetric(*overlap, metric)
+		}
+	case *merge == "weighted":
+		opts.Merge = func(m haar.Matches) haar.Matches {
+			return m.WeightedJoinOverlaps(*overlap, metric)
+		}
+	case *merge == "nms":
+		opts.Merge = func(m haar.Matches) haar.Matches {
+			return m.NonMaxSuppression(*overlap, metric)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "Invalid merge strategy:", *merge)
+		os.Exit(1)
+	}
+	// Average precision ranks the detections down to the
+	// lowest offset, so the scans always keep them.
+	opts.MinOffset = *sweepMin
+
+	cascadeData, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read cascade:", err)
+		os.Exit(1)
+	}
+	var cascade haar.Cascade
+	if err := json.Unmarshal(cascadeData, &cascade); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse cascade:", err)
+		os.Exit(1)
+	}
+
+	annotations, err := dataset.Load(*format, args[1], *imageDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to load annotations:", err)
+		os.Exit(1)
+	}
+
+	evaluator := eval.NewEvaluator(&cascade, &opts)
+	for i, annotation := range annotations {
+		log.Printf("Scanning image %d/%d: %s", i+1, len(annotations), annotation.Path)
+		img, err := annotation.Image()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to read image:", err)
+			os.Exit(1)
+		}
+		err = evaluator.AddImage(context.Background(), img, annotation.Rects(*label),
+			annotation.Ignored(*label))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to scan image:", err)
+			os.Exit(1)
+		}
+	}
+
+	res := evaluator.Result()
+	fmt.Printf("Images: %d\n", res.Images)
+	fmt.Printf("Ground truth: %d\n", res.Truths)
+	fmt.Printf("Detections: %d\n", res.Detections)
+	fmt.Printf("Precision: %f\n", res.Precision)
+	fmt.Printf("Recall: %f\n", res.Recall)
+	fmt.Printf("False positives per image: %f\n", res.FalsePositivesPerImage)
+	fmt.Printf("Average precision (offsets down to %g): %f\n", *sweepMin,
+		evaluator.AveragePrecision())
+
+	if *curvePath != "" {
+		var offsets []float64
+		for i := 0; i <= *sweepSteps; i++ {
+			frac := float64(i) / float64(*sweepSteps)
+			offsets = append(offsets, *sweepMin+frac*(*sweepMax-*sweepMin))
+		}
+		if err := writeCurve(*curvePath, evaluator.Curve(offsets)); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to write curve:", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func writeCurve(path string, curve []*eval.Result) error {
+	if strings.HasSuffix(strings.ToLower(path), ".json") {
+		data, err := json.Marshal(curve)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, data, 0644)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"offset", "detections", "true_positives", "false_positives",
+		"false_negatives", "precision", "recall", "false_positives_per_image"})
+	for _, res := range curve {
+		w.Write([]string{
+			strconv.FormatFloat(res.Offset, 'f', -1, 64),
+			strconv.Itoa(res.Detections),
+			strconv.Itoa(res.TruePositives),
+			strconv.Itoa(res.FalsePositives),
+			strconv.Itoa(res.FalseNegatives),
+			strconv.FormatFloat(res.Precision, 'f', -1, 64),
+			strconv.FormatFloat(res.Recall, 'f', -1, 64),
+			strconv.FormatFloat(res.FalsePositivesPerImage, 'f', -1, 64),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
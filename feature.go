@@ -1,6 +1,9 @@
 package haar
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+)
 
 type FeatureType int
 
@@ -10,8 +13,89 @@ const (
 	HorizontalTriple
 	VerticalTriple
 	Diagonal
+
+	// The tilted feature types are like the upright ones,
+	// but rotated 45 degrees clockwise.
+	TiltedHorizontalPair
+	TiltedVerticalPair
+	TiltedHorizontalTriple
+	TiltedVerticalTriple
+
+	// CenterSurround divides the feature into a 3x3 grid
+	// and subtracts the center from the surrounding ring.
+	CenterSurround
+
+	// HorizontalQuad and VerticalQuad divide the feature
+	// into four strips and subtract the middle two strips
+	// from the outer two.
+	HorizontalQuad
+	VerticalQuad
+
+	// HorizontalGapPair and VerticalGapPair divide the
+	// feature into three strips and subtract the last
+	// strip from the first, ignoring the middle one.
+	HorizontalGapPair
+	VerticalGapPair
 )
 
+var featureTypeNames = []string{
+	"horizontal-pair",
+	"vertical-pair",
+	"horizontal-triple",
+	"vertical-triple",
+	"diagonal",
+	"tilted-horizontal-pair",
+	"tilted-vertical-pair",
+	"tilted-horizontal-triple",
+	"tilted-vertical-triple",
+	"center-surround",
+	"horizontal-quad",
+	"vertical-quad",
+	"horizontal-gap-pair",
+	"vertical-gap-pair",
+}
+
+// ParseFeatureType finds the feature type with the given
+// name, as returned by FeatureType.String.
+func ParseFeatureType(name string) (FeatureType, error) {
+	for i, x := range featureTypeNames {
+		if x == name {
+			return FeatureType(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown feature type: %s", name)
+}
+
+// String returns a name for the feature type, such as
+// "horizontal-pair".
+func (f FeatureType) String() string {
+	if f < 0 || int(f) >= len(featureTypeNames) {
+		return fmt.Sprintf("FeatureType(%d)", int(f))
+	}
+	return featureTypeNames[f]
+}
+
+// Basic returns whether the feature type is one of the
+// five upright types of Viola and Jones, which are the
+// types used by AllFeatures.
+func (f FeatureType) Basic() bool {
+	return f >= HorizontalPair && f <= Diagonal
+}
+
+// Tilted returns whether the feature type is rotated by
+// 45 degrees.
+// Tilted features can only be evaluated on images which
+// implement TiltedIntegralImage, such as the images from
+// BitmapIntegralImage and the windows of a DualImage.
+func (f FeatureType) Tilted() bool {
+	switch f {
+	case TiltedHorizontalPair, TiltedVerticalPair, TiltedHorizontalTriple,
+		TiltedVerticalTriple:
+		return true
+	}
+	return false
+}
+
 // A Feature is a Haar-like feature.
 // Features are computed by subtracting the pixel sums
 // in some rectangles from those in others.
@@ -20,6 +104,11 @@ type Feature struct {
 
 	// These coordinates define the bounding box of the
 	// feature inside the window.
+	//
+	// For tilted features, (X, Y) is the top pixel of the
+	// feature, Width is its extent down and to the right,
+	// and Height is its extent down and to the left.
+	// A tilted feature covers 2*Width*Height pixels.
 	X      int
 	Y      int
 	Width  int
@@ -27,9 +116,41 @@ type Feature struct {
 }
 
 // AllFeatures builds a list of every haar-like feature
-// that fits in the given window size.
+// of a basic type that fits in the given window size.
+//
+// The other feature types, such as the tilted ones, can
+// be listed with FeaturesOfTypes.
 func AllFeatures(width, height int) []*Feature {
 	var res []*Feature
+	forEachFeature(width, height, func(f Feature) {
+		if f.Type.Basic() {
+			res = append(res, &f)
+		}
+	})
+	return res
+}
+
+// FeaturesOfTypes builds a list of every haar-like
+// feature of the given types that fits in the given
+// window size.
+// The features are in the same order as AllFeatures.
+func FeaturesOfTypes(width, height int, types ...FeatureType) []*Feature {
+	var res []*Feature
+	forEachFeature(width, height, func(f Feature) {
+		for _, t := range types {
+			if f.Type == t {
+				res = append(res, &f)
+				break
+			}
+		}
+	})
+	return res
+}
+
+// forEachFeature calls fn with every haar-like feature
+// of any type that fits in the given window size, in the
+// same order as AllFeatures.
+func forEachFeature(width, height int, fn func(f Feature)) {
 	for w := 1; w <= width; w++ {
 		for h := 1; h <= height; h++ {
 			if h == 1 && w == 1 {
@@ -41,33 +162,86 @@ func AllFeatures(width, height int) []*Feature {
 					if w%2 == 0 {
 						hf := f
 						hf.Type = HorizontalPair
-						res = append(res, &hf)
+						fn(hf)
 					}
 					if h%2 == 0 {
 						vf := f
 						vf.Type = VerticalPair
-						res = append(res, &vf)
+						fn(vf)
 					}
 					if w%2 == 0 && h%2 == 0 {
 						df := f
 						df.Type = Diagonal
-						res = append(res, &df)
+						fn(df)
 					}
 					if w%3 == 0 {
 						hf := f
 						hf.Type = HorizontalTriple
-						res = append(res, &hf)
+						fn(hf)
 					}
 					if h%3 == 0 {
 						vf := f
 						vf.Type = VerticalTriple
-						res = append(res, &vf)
+						fn(vf)
+					}
+					if w%3 == 0 && h%3 == 0 {
+						cf := f
+						cf.Type = CenterSurround
+						fn(cf)
+					}
+					if w%4 == 0 {
+						hf := f
+						hf.Type = HorizontalQuad
+						fn(hf)
+					}
+					if h%4 == 0 {
+						vf := f
+						vf.Type = VerticalQuad
+						fn(vf)
+					}
+					if w%3 == 0 {
+						hf := f
+						hf.Type = HorizontalGapPair
+						fn(hf)
+					}
+					if h%3 == 0 {
+						vf := f
+						vf.Type = VerticalGapPair
+						fn(vf)
+					}
+				}
+			}
+		}
+	}
+	for w := 1; w < width; w++ {
+		for h := 1; w+h <= width && w+h <= height; h++ {
+			for y := 0; y+w+h <= height; y++ {
+				for x := h; x+w <= width; x++ {
+					f := Feature{X: x, Y: y, Width: w, Height: h}
+					if w%2 == 0 {
+						hf := f
+						hf.Type = TiltedHorizontalPair
+						fn(hf)
+					}
+					if h%2 == 0 {
+						vf := f
+						vf.Type = TiltedVerticalPair
+						fn(vf)
+					}
+					if w%3 == 0 {
+						hf := f
+						hf.Type = TiltedHorizontalTriple
+						fn(hf)
+					}
+					if h%3 == 0 {
+						vf := f
+						vf.Type = TiltedVerticalTriple
+						fn(vf)
 					}
 				}
 			}
 		}
 	}
-	return res
 }
 
 // Value evaluates the feature on the given window.
@@ -79,11 +253,171 @@ func (f *Feature) Value(img IntegralImage) float64 {
 		return f.triple(img, f.Type == HorizontalTriple)
 	case Diagonal:
 		return f.diagonal(img)
+	case TiltedHorizontalPair, TiltedVerticalPair, TiltedHorizontalTriple,
+		TiltedVerticalTriple:
+		return f.tilted(img)
+	case CenterSurround:
+		return f.rectangleSum(img, 0, 0, 3, 3) - 2*f.rectangleSum(img, 1, 1, 1, 1)
+	case HorizontalQuad:
+		return f.rectangleSum(img, 0, 0, 4, 1) - 2*f.rectangleSum(img, 1, 0, 2, 1)
+	case VerticalQuad:
+		return f.rectangleSum(img, 0, 0, 1, 4) - 2*f.rectangleSum(img, 0, 1, 1, 2)
+	case HorizontalGapPair:
+		return f.rectangleSum(img, 0, 0, 1, 1) - f.rectangleSum(img, 2, 0, 1, 1)
+	case VerticalGapPair:
+		return f.rectangleSum(img, 0, 0, 1, 1) - f.rectangleSum(img, 0, 2, 1, 1)
+	default:
+		panic(fmt.Sprintf("unknown feature type: %d", f.Type))
+	}
+}
+
+// Scaled creates a version of the feature for a window
+// which is scaled by the given factors.
+//
+// The scaled feature's rectangles are rounded to whole
+// pixels while keeping the sub-rectangles the same size.
+// Because of rounding, the scaled feature may not cover
+// exactly the scaled area of the original feature.
+// Multiplying the scaled feature's value by areaScale
+// compensates for this, yielding an approximation of the
+// original feature's value on the unscaled window.
+//
+// Tilted features are scaled by the geometric mean of
+// xScale and yScale in both directions.
+//
+// The windowWidth and windowHeight arguments specify the
+// size of the scaled window, which the scaled feature is
+// guaranteed to fit inside.
+func (f *Feature) Scaled(xScale, yScale float64, windowWidth,
+	windowHeight int) (feature *Feature, areaScale float64) {
+	res, areaScale := f.scaled(xScale, yScale, windowWidth, windowHeight)
+	return &res, areaScale
+}
+
+// ScaledFeature is like Scaled, but it returns a
+// WindowFeature so that Feature implements
+// ScalableFeature.
+func (f *Feature) ScaledFeature(xScale, yScale float64, windowWidth,
+	windowHeight int) (feature WindowFeature, areaScale float64) {
+	return f.Scaled(xScale, yScale, windowWidth, windowHeight)
+}
+
+// Kind returns HaarFeatureKind.
+func (f *Feature) Kind() string {
+	return HaarFeatureKind
+}
+
+func (f *Feature) scaled(xScale, yScale float64, windowWidth,
+	windowHeight int) (res Feature, areaScale float64) {
+	if f.Type.Tilted() {
+		return f.tiltedScaled(math.Sqrt(xScale*yScale), windowWidth, windowHeight)
+	}
+	xParts, yParts := f.parts()
+	res = *f
+	res.Width = scaleFeatureSize(f.Width, xScale, xParts, windowWidth)
+	res.Height = scaleFeatureSize(f.Height, yScale, yParts, windowHeight)
+	res.X = scaleFeatureCoord(f.X, xScale, res.Width, windowWidth)
+	res.Y = scaleFeatureCoord(f.Y, yScale, res.Height, windowHeight)
+	areaScale = float64(f.Width*f.Height) / float64(res.Width*res.Height)
+	return
+}
+
+// tiltedScaled scales a tilted feature.
+// Since a rotated rectangle cannot be stretched along the
+// x and y axes, the feature is scaled by the same amount
+// in every direction.
+func (f *Feature) tiltedScaled(scale float64, windowWidth,
+	windowHeight int) (res Feature, areaScale float64) {
+	widthParts, heightParts := f.parts()
+	maxSize := windowWidth
+	if windowHeight < maxSize {
+		maxSize = windowHeight
+	}
+	res = *f
+	res.Width = scaleFeatureSize(f.Width, scale, widthParts, maxSize-heightParts)
+	res.Height = scaleFeatureSize(f.Height, scale, heightParts, maxSize-res.Width)
+	res.X = int(float64(f.X)*scale + 0.5)
+	if res.X < res.Height {
+		res.X = res.Height
+	} else if res.X+res.Width > windowWidth {
+		res.X = windowWidth - res.Width
+	}
+	res.Y = scaleFeatureCoord(f.Y, scale, res.Width+res.Height, windowHeight)
+	areaScale = float64(f.Width*f.Height) / float64(res.Width*res.Height)
+	return
+}
+
+// parts returns the number of equally sized parts the
+// feature is divided into horizontally and vertically.
+// For tilted features, these are the numbers of parts
+// along the width and height.
+func (f *Feature) parts() (x, y int) {
+	switch f.Type {
+	case HorizontalPair:
+		return 2, 1
+	case VerticalPair:
+		return 1, 2
+	case HorizontalTriple:
+		return 3, 1
+	case VerticalTriple:
+		return 1, 3
+	case Diagonal:
+		return 2, 2
+	case TiltedHorizontalPair:
+		return 2, 1
+	case TiltedVerticalPair:
+		return 1, 2
+	case TiltedHorizontalTriple:
+		return 3, 1
+	case TiltedVerticalTriple:
+		return 1, 3
+	case CenterSurround:
+		return 3, 3
+	case HorizontalQuad:
+		return 4, 1
+	case VerticalQuad:
+		return 1, 4
+	case HorizontalGapPair:
+		return 3, 1
+	case VerticalGapPair:
+		return 1, 3
 	default:
 		panic(fmt.Sprintf("unknown feature type: %d", f.Type))
 	}
 }
 
+func scaleFeatureSize(size int, scale float64, parts, max int) int {
+	partSize := int(float64(size)*scale/float64(parts) + 0.5)
+	if partSize < 1 {
+		partSize = 1
+	}
+	for partSize > 1 && partSize*parts > max {
+		partSize--
+	}
+	return partSize * parts
+}
+
+func scaleFeatureCoord(coord int, scale float64, size, max int) int {
+	res := int(float64(coord)*scale + 0.5)
+	if res+size > max {
+		res = max - size
+	}
+	return res
+}
+
+// rectangleSum computes the sum of a rectangle made up of
+// some of the feature's parts.
+// The rectangle's position and size are measured in parts
+// rather than pixels.
+func (f *Feature) rectangleSum(img IntegralImage, x, y, w, h int) float64 {
+	xParts, yParts := f.parts()
+	partWidth, partHeight := f.Width/xParts, f.Height/yParts
+	minX, minY := f.X+x*partWidth, f.Y+y*partHeight
+	maxX, maxY := minX+w*partWidth, minY+h*partHeight
+	return img.IntegralAt(maxX, maxY) + img.IntegralAt(minX, minY) -
+		(img.IntegralAt(maxX, minY) + img.IntegralAt(minX, maxY))
+}
+
 func (f *Feature) pair(img IntegralImage, horizontal bool) float64 {
 	var sum1, sum2 float64
 	if horizontal {
@@ -149,3 +483,33 @@ func (f *Feature) diagonal(img IntegralImage) float64 {
 		(integralValues[2][1] + integralValues[1][2])
 	return topLeft + bottomRight - (topRight + bottomLeft)
 }
+
+func (f *Feature) tilted(img IntegralImage) float64 {
+	if s, ok := img.(*scaledImage); ok {
+		// Scaling the corners of a tilted feature one at a
+		// time would not yield a rotated rectangle, so the
+		// feature itself is scaled instead.
+		scaled, areaScale := f.scaled(s.xUnscale, s.yUnscale, s.img.Width(),
+			s.img.Height())
+		return scaled.tilted(s.img) * areaScale
+	}
+	tiltedImg, ok := img.(TiltedIntegralImage)
+	if !ok {
+		panic("tilted features require a TiltedIntegralImage")
+	}
+
+	widthParts, heightParts := f.parts()
+	w, h := f.Width/widthParts, f.Height/heightParts
+	var sums [3]float64
+	for i := 0; i < widthParts*heightParts; i++ {
+		if widthParts > 1 {
+			sums[i] = tiltedRectSum(tiltedImg, f.X+i*w, f.Y+i*w, w, h)
+		} else {
+			sums[i] = tiltedRectSum(tiltedImg, f.X-i*h, f.Y+i*h, w, h)
+		}
+	}
+	if widthParts*heightParts == 2 {
+		return sums[0] - sums[1]
+	}
+	return sums[0] + sums[2] - sums[1]
+}
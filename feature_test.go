@@ -65,6 +65,42 @@ func TestBuiltinFeatures(t *testing.T) {
 			Expected: rectangleSum(img, 1, 1, 3, 2) + rectangleSum(img, 1, 5, 3, 2) -
 				rectangleSum(img, 1, 3, 3, 2),
 		},
+		{
+			Desc:    "center surround",
+			Feature: &Feature{CenterSurround, 1, 1, 6, 3},
+			Expected: rectangleSum(img, 1, 1, 6, 1) + rectangleSum(img, 1, 3, 6, 1) +
+				rectangleSum(img, 1, 2, 2, 1) + rectangleSum(img, 5, 2, 2, 1) -
+				rectangleSum(img, 3, 2, 2, 1),
+		},
+		{
+			Desc:    "center surround (square)",
+			Feature: &Feature{CenterSurround, 0, 2, 3, 3},
+			Expected: rectangleSum(img, 0, 2, 3, 1) + rectangleSum(img, 0, 4, 3, 1) +
+				rectangleSum(img, 0, 3, 1, 1) + rectangleSum(img, 2, 3, 1, 1) -
+				rectangleSum(img, 1, 3, 1, 1),
+		},
+		{
+			Desc:    "horizontal quad",
+			Feature: &Feature{HorizontalQuad, 0, 1, 4, 3},
+			Expected: rectangleSum(img, 0, 1, 1, 3) + rectangleSum(img, 3, 1, 1, 3) -
+				(rectangleSum(img, 1, 1, 1, 3) + rectangleSum(img, 2, 1, 1, 3)),
+		},
+		{
+			Desc:    "vertical quad",
+			Feature: &Feature{VerticalQuad, 1, 0, 2, 4},
+			Expected: rectangleSum(img, 1, 0, 2, 1) + rectangleSum(img, 1, 3, 2, 1) -
+				(rectangleSum(img, 1, 1, 2, 1) + rectangleSum(img, 1, 2, 2, 1)),
+		},
+		{
+			Desc:     "horizontal gap pair",
+			Feature:  &Feature{HorizontalGapPair, 1, 1, 6, 2},
+			Expected: rectangleSum(img, 1, 1, 2, 2) - rectangleSum(img, 5, 1, 2, 2),
+		},
+		{
+			Desc:     "vertical gap pair",
+			Feature:  &Feature{VerticalGapPair, 2, 1, 3, 6},
+			Expected: rectangleSum(img, 2, 1, 3, 2) - rectangleSum(img, 2, 5, 3, 2),
+		},
 	}
 	for _, test := range tests {
 		actual := test.Feature.Value(img)
@@ -74,6 +110,172 @@ func TestBuiltinFeatures(t *testing.T) {
 	}
 }
 
+func TestAllFeatures(t *testing.T) {
+	all := AllFeatures(7, 6)
+	if len(all) == 0 {
+		t.Fatal("expected some features")
+	}
+	for _, f := range all {
+		if !f.Type.Basic() {
+			t.Fatalf("unexpected feature type: %v", f)
+		}
+	}
+	basic := FeaturesOfTypes(7, 6, HorizontalPair, VerticalPair, HorizontalTriple,
+		VerticalTriple, Diagonal)
+	if len(basic) != len(all) {
+		t.Fatalf("expected %d features got %d", len(all), len(basic))
+	}
+	for i, f := range basic {
+		if *f != *all[i] {
+			t.Fatalf("feature %d: expected %v got %v", i, *all[i], *f)
+		}
+	}
+	tilted := FeaturesOfTypes(7, 6, TiltedVerticalPair)
+	if len(tilted) == 0 {
+		t.Fatal("expected some tilted features")
+	}
+	for _, f := range tilted {
+		if f.Type != TiltedVerticalPair {
+			t.Fatalf("unexpected feature type: %v", f)
+		}
+	}
+}
+
+func TestFeatureScaled(t *testing.T) {
+	img := featureTestImage()
+
+	// Upsample the image by a factor of two in each
+	// direction by duplicating pixels.
+	bigWidth, bigHeight := imageTestBitmapWidth*2, imageTestBitmapHeight*2
+	bigPixels := make([]float64, bigWidth*bigHeight)
+	for y := 0; y < bigHeight; y++ {
+		for x := 0; x < bigWidth; x++ {
+			bigPixels[x+y*bigWidth] = imageTestBitmap[x/2+(y/2)*imageTestBitmapWidth]
+		}
+	}
+	bigImg := BitmapIntegralImage(bigPixels, bigWidth, bigHeight)
+
+	for _, feature := range everyFeature(imageTestBitmapWidth, imageTestBitmapHeight) {
+		if feature.Type.Tilted() {
+			// Tilted features do not scale exactly, since
+			// their edges are jagged.
+			continue
+		}
+		scaled, areaScale := feature.Scaled(2, 2, bigWidth, bigHeight)
+		expected := feature.Value(img)
+		actual := scaled.Value(bigImg) * areaScale
+		if math.Abs(actual-expected) > 1e-5 {
+			t.Errorf("feature %v: expected %f got %f", feature, expected, actual)
+		}
+	}
+
+	for _, feature := range everyFeature(imageTestBitmapWidth, imageTestBitmapHeight) {
+		scaled, _ := feature.Scaled(1.3, 0.7, 9, 5)
+		if scaled.X < 0 || scaled.Y < 0 || scaled.X+scaled.Width > 9 ||
+			scaled.Y+scaled.Height > 5 {
+			t.Errorf("feature %v scaled out of bounds: %v", feature, scaled)
+		}
+		if feature.Type.Tilted() && (scaled.X < scaled.Height ||
+			scaled.Y+scaled.Width+scaled.Height > 5) {
+			t.Errorf("tilted feature %v scaled out of bounds: %v", feature, scaled)
+		}
+		xParts, yParts := feature.parts()
+		if scaled.Width%xParts != 0 || scaled.Height%yParts != 0 {
+			t.Errorf("feature %v scaled to uneven parts: %v", feature, scaled)
+		}
+	}
+}
+
+func TestTiltedIntegrals(t *testing.T) {
+	table := newTiltedTable(imageTestBitmap, imageTestBitmapWidth, imageTestBitmapHeight)
+	for y := 0; y <= imageTestBitmapHeight; y++ {
+		for x := 0; x <= imageTestBitmapWidth; x++ {
+			var expected float64
+			for py := 0; py < y; py++ {
+				for px := 0; px < imageTestBitmapWidth; px++ {
+					dx := px - x
+					if dx < 0 {
+						dx = -dx
+					}
+					if dx < y-py {
+						expected += imageTestBitmap[px+py*imageTestBitmapWidth]
+					}
+				}
+			}
+			if actual := table.at(x, y); math.Abs(actual-expected) > 1e-8 {
+				t.Errorf("integral at %d,%d: expected %f got %f", x, y, expected, actual)
+			}
+		}
+	}
+}
+
+func TestTiltedFeatures(t *testing.T) {
+	dual := NewDualImage(featureTestImage())
+	img := dual.Window(1, 2, 6, 5)
+
+	// Compute the normalized pixels of the window.
+	var mean, sqMean float64
+	pixels := make([]float64, 6*5)
+	for i := range pixels {
+		x, y := i%6+1, i/6+2
+		pixels[i] = imageTestBitmap[x+y*imageTestBitmapWidth]
+		mean += pixels[i] / float64(len(pixels))
+		sqMean += pixels[i] * pixels[i] / float64(len(pixels))
+	}
+	stddev := math.Sqrt(sqMean - mean*mean)
+	for i := range pixels {
+		pixels[i] = (pixels[i] - mean) / stddev
+	}
+
+	// rotatedSum sums the pixels of a rotated rectangle
+	// by checking every pixel in the window.
+	rotatedSum := func(x, y, w, h int) float64 {
+		var sum float64
+		var count int
+		for py := 0; py < 5; py++ {
+			for px := 0; px < 6; px++ {
+				s, d := px+py-(x+y), py-px-(y-x)
+				if s >= 0 && s < 2*w && d >= 0 && d < 2*h && (s+d)%2 == 0 {
+					sum += pixels[px+py*6]
+					count++
+				}
+			}
+		}
+		if count != 2*w*h {
+			t.Fatalf("rectangle %d,%d,%d,%d has %d pixels", x, y, w, h, count)
+		}
+		return sum
+	}
+
+	var numTilted int
+	for _, feature := range everyFeature(6, 5) {
+		if !feature.Type.Tilted() {
+			continue
+		}
+		numTilted++
+		xParts, yParts := feature.parts()
+		w, h := feature.Width/xParts, feature.Height/yParts
+		var sums []float64
+		for i := 0; i < xParts*yParts; i++ {
+			if xParts > 1 {
+				sums = append(sums, rotatedSum(feature.X+i*w, feature.Y+i*w, w, h))
+			} else {
+				sums = append(sums, rotatedSum(feature.X-i*h, feature.Y+i*h, w, h))
+			}
+		}
+		expected := sums[0] - sums[1]
+		if len(sums) == 3 {
+			expected = sums[0] + sums[2] - sums[1]
+		}
+		if actual := feature.Value(img); math.Abs(actual-expected) > 1e-5 {
+			t.Errorf("feature %v: expected %f got %f", feature, expected, actual)
+		}
+	}
+	if numTilted == 0 {
+		t.Error("no tilted features")
+	}
+}
+
 func featureTestImage() IntegralImage {
 	return BitmapIntegralImage(imageTestBitmap, imageTestBitmapWidth,
 		imageTestBitmapHeight)
@@ -83,3 +285,13 @@ func rectangleSum(img IntegralImage, x, y, w, h int) float64 {
 	return img.IntegralAt(x+w, y+h) + img.IntegralAt(x, y) -
 		(img.IntegralAt(x+w, y) + img.IntegralAt(x, y+h))
 }
+
+// everyFeature lists the features of every type for the
+// given window size.
+func everyFeature(width, height int) []*Feature {
+	var types []FeatureType
+	for t := HorizontalPair; t <= VerticalGapPair; t++ {
+		types = append(types, t)
+	}
+	return FeaturesOfTypes(width, height, types...)
+}
@@ -0,0 +1,182 @@
+package haar
+
+import "math"
+
+// pixelLevels is the brightness of a white pixel in the
+// integer integral formats.
+const pixelLevels = 255
+
+func quantizePixel(brightness float64) uint32 {
+	return uint32(math.Max(0, math.Min(pixelLevels, math.Floor(brightness*pixelLevels+0.5))))
+}
+
+type float32IntegralImage struct {
+	integrals []float32
+	width     int
+	height    int
+}
+
+func float32IntegralImageFromBitmap(pixels []float64, width, height int) IntegralImage {
+	res := &float32IntegralImage{
+		integrals: make([]float32, (width+1)*(height+1)),
+		width:     width,
+		height:    height,
+	}
+
+	// Accumulating in float64 prevents rounding errors
+	// from building up across rows.
+	lastRow := make([]float64, width+1)
+	for y := 0; y < height; y++ {
+		var rowSum float64
+		for x := 0; x < width; x++ {
+			rowSum += pixels[x+width*y]
+			lastRow[x+1] += rowSum
+			res.integrals[(x+1)+(width+1)*(y+1)] = float32(lastRow[x+1])
+		}
+	}
+
+	return res
+}
+
+func (f *float32IntegralImage) Width() int {
+	return f.width
+}
+
+func (f *float32IntegralImage) Height() int {
+	return f.height
+}
+
+func (f *float32IntegralImage) IntegralAt(x, y int) float64 {
+	if x <= 0 || y <= 0 {
+		return 0
+	}
+	return float64(f.integrals[x+(f.width+1)*y])
+}
+
+// integerIntegralImage creates an IntegralImage from
+// integer pixel values, where a pixel value of unit
+// corresponds to a brightness of 1.
+//
+// If wide is true, the integrals are stored as uint64s.
+// Otherwise, they are stored as uint32s.
+func integerIntegralImage(levels []uint32, width, height int, unit uint64,
+	wide bool) IntegralImage {
+	if wide {
+		integrals := make([]uint64, (width+1)*(height+1))
+		for y := 0; y < height; y++ {
+			var rowSum uint64
+			for x := 0; x < width; x++ {
+				rowSum += uint64(levels[x+width*y])
+				integrals[(x+1)+(width+1)*(y+1)] = integrals[(x+1)+(width+1)*y] + rowSum
+			}
+		}
+		return &uint64IntegralImage{
+			integrals: integrals,
+			width:     width,
+			height:    height,
+			scale:     1 / float64(unit),
+		}
+	}
+
+	integrals := make([]uint32, (width+1)*(height+1))
+	for y := 0; y < height; y++ {
+		var rowSum uint32
+		for x := 0; x < width; x++ {
+			rowSum += levels[x+width*y]
+			integrals[(x+1)+(width+1)*(y+1)] = integrals[(x+1)+(width+1)*y] + rowSum
+		}
+	}
+	return &uint32IntegralImage{
+		integrals: integrals,
+		width:     width,
+		height:    height,
+		scale:     1 / float64(unit),
+	}
+}
+
+type uint32IntegralImage struct {
+	integrals []uint32
+	width     int
+	height    int
+	scale     float64
+}
+
+func (u *uint32IntegralImage) Width() int {
+	return u.width
+}
+
+func (u *uint32IntegralImage) Height() int {
+	return u.height
+}
+
+func (u *uint32IntegralImage) IntegralAt(x, y int) float64 {
+	if x <= 0 || y <= 0 {
+		return 0
+	}
+	return float64(u.integrals[x+(u.width+1)*y]) * u.scale
+}
+
+type uint64IntegralImage struct {
+	integrals []uint64
+	width     int
+	height    int
+	scale     float64
+}
+
+func (u *uint64IntegralImage) Width() int {
+	return u.width
+}
+
+func (u *uint64IntegralImage) Height() int {
+	return u.height
+}
+
+func (u *uint64IntegralImage) IntegralAt(x, y int) float64 {
+	if x <= 0 || y <= 0 {
+		return 0
+	}
+	return float64(u.integrals[x+(u.width+1)*y]) * u.scale
+}
+
+// An integralTable gives direct access to the integrals
+// of an image in their native format.
+//
+// Exactly one of the slices is non-nil, and it stores the
+// integral at (x, y) at index x+(width+1)*y.
+type integralTable struct {
+	float64s []float64
+	float32s []float32
+	uint32s  []uint32
+	uint64s  []uint64
+
+	// scale converts integer integrals to brightness.
+	scale float64
+}
+
+func newIntegralTable(img IntegralImage) integralTable {
+	switch img := img.(type) {
+	case *sliceIntegralImage:
+		return integralTable{float64s: img.integrals}
+	case *float32IntegralImage:
+		return integralTable{float32s: img.integrals}
+	case *uint32IntegralImage:
+		return integralTable{uint32s: img.integrals, scale: img.scale}
+	case *uint64IntegralImage:
+		return integralTable{uint64s: img.integrals, scale: img.scale}
+	default:
+		return integralTable{float64s: paddedIntegrals(img)}
+	}
+}
+
+func (i *integralTable) at(offset int) float64 {
+	switch {
+	case i.float64s != nil:
+		return i.float64s[offset]
+	case i.float32s != nil:
+		return float64(i.float32s[offset])
+	case i.uint32s != nil:
+		return float64(i.uint32s[offset]) * i.scale
+	default:
+		return float64(i.uint64s[offset]) * i.scale
+	}
+}
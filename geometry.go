@@ -0,0 +1,253 @@
+package haar
+
+import (
+	"image"
+	"math"
+)
+
+// MatchFromRect creates a match covering a rectangle.
+func MatchFromRect(r image.Rectangle) *Match {
+	r = r.Canon()
+	return &Match{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+// Rect returns the match's rectangle, ignoring its Angle.
+func (m *Match) Rect() image.Rectangle {
+	return image.Rect(m.X, m.Y, m.X+m.Width, m.Y+m.Height)
+}
+
+// Bounds returns the smallest rectangle which contains
+// the match, taking its Angle into account.
+// Tiny rounding errors are ignored, so that right angles
+// give exact bounds.
+func (m *Match) Bounds() image.Rectangle {
+	if m.Angle == 0 {
+		return m.Rect()
+	}
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, corner := range m.Corners() {
+		minX, maxX = math.Min(minX, corner[0]), math.Max(maxX, corner[0])
+		minY, maxY = math.Min(minY, corner[1]), math.Max(maxY, corner[1])
+	}
+	const epsilon = 1e-8
+	return image.Rect(int(math.Floor(minX+epsilon)), int(math.Floor(minY+epsilon)),
+		int(math.Ceil(maxX-epsilon)), int(math.Ceil(maxY-epsilon)))
+}
+
+// Area returns the area of the match.
+func (m *Match) Area() int {
+	return m.Width * m.Height
+}
+
+// Center returns the center of the match.
+func (m *Match) Center() (x, y float64) {
+	return float64(m.X) + float64(m.Width)/2, float64(m.Y) + float64(m.Height)/2
+}
+
+// Corners returns the corners of the match's rotated
+// rectangle, clockwise from the top-left corner.
+func (m *Match) Corners() [4][2]float64 {
+	centerX := float64(m.X) + float64(m.Width)/2
+	centerY := float64(m.Y) + float64(m.Height)/2
+	cos, sin := math.Cos(m.Angle), math.Sin(m.Angle)
+	var res [4][2]float64
+	for i, offset := range [4][2]float64{{-1, -1}, {1, -1}, {1, 1}, {-1, 1}} {
+		x := offset[0] * float64(m.Width) / 2
+		y := offset[1] * float64(m.Height) / 2
+		res[i] = [2]float64{centerX + cos*x - sin*y, centerY + sin*x + cos*y}
+	}
+	return res
+}
+
+// Intersect returns the intersection of the rectangles
+// of two matches, ignoring their angles.
+// If the matches do not overlap, the result is empty.
+func (m *Match) Intersect(m1 *Match) image.Rectangle {
+	return m.Rect().Intersect(m1.Rect())
+}
+
+// Union returns the smallest rectangle which contains
+// the rectangles of both matches, ignoring their angles.
+func (m *Match) Union(m1 *Match) image.Rectangle {
+	return m.Rect().Union(m1.Rect())
+}
+
+// IoU returns the intersection over union of two
+// matches, which is the area covered by both matches
+// divided by the area covered by either match.
+//
+// If either match has an Angle, the IoU is computed
+// between the rotated rectangles.
+func (m *Match) IoU(m1 *Match) float64 {
+	intersection := m.intersection(m1)
+	if intersection == 0 {
+		return 0
+	}
+	union := float64(m.Width*m.Height+m1.Width*m1.Height) - intersection
+	return intersection / union
+}
+
+func (m *Match) intersection(m1 *Match) float64 {
+	if m.Angle != 0 || m1.Angle != 0 {
+		return rotatedIntersection(m, m1)
+	}
+	width := math.Min(float64(m.X+m.Width), float64(m1.X+m1.Width)) -
+		math.Max(float64(m.X), float64(m1.X))
+	height := math.Min(float64(m.Y+m.Height), float64(m1.Y+m1.Height)) -
+		math.Max(float64(m.Y), float64(m1.Y))
+	if width <= 0 || height <= 0 {
+		return 0
+	}
+	return width * height
+}
+
+// ScaledAboutCenter creates a copy of the match whose
+// size is multiplied by factor, keeping the same center.
+// The result is rounded to the nearest pixel.
+func (m *Match) ScaledAboutCenter(factor float64) *Match {
+	res := *m
+	x, y := m.Center()
+	res.Width = roundInt(float64(m.Width) * factor)
+	res.Height = roundInt(float64(m.Height) * factor)
+	res.X = roundInt(x - float64(res.Width)/2)
+	res.Y = roundInt(y - float64(res.Height)/2)
+	return &res
+}
+
+// Clamp creates a copy of the match whose rectangle is
+// cut down to fit inside the given bounds.
+// The match's Angle is ignored, so rotated matches may
+// still extend past the bounds.
+// If the match is outside of the bounds, the result has a
+// width and height of 0.
+func (m *Match) Clamp(bounds image.Rectangle) *Match {
+	res := *m
+	r := m.Rect().Intersect(bounds)
+	res.X, res.Y = r.Min.X, r.Min.Y
+	res.Width, res.Height = r.Dx(), r.Dy()
+	return &res
+}
+
+// Add creates a copy of the match translated by p.
+//
+// For example, a match found in a crop of an image whose
+// top-left corner is p can be mapped to the full image
+// with Add(p).
+func (m *Match) Add(p image.Point) *Match {
+	res := *m
+	res.X += p.X
+	res.Y += p.Y
+	return &res
+}
+
+// Sub creates a copy of the match translated by -p.
+//
+// For example, a match in an image can be mapped into a
+// crop of the image whose top-left corner is p with
+// Sub(p).
+func (m *Match) Sub(p image.Point) *Match {
+	return m.Add(image.Pt(-p.X, -p.Y))
+}
+
+// Scaled creates a copy of the match for an image which
+// is factor times as large, such as a different level of
+// an image pyramid.
+// The result is rounded to the nearest pixel, and its
+// Scale is multiplied by factor.
+func (m *Match) Scaled(factor float64) *Match {
+	res := *m
+	res.X = roundInt(float64(m.X) * factor)
+	res.Y = roundInt(float64(m.Y) * factor)
+	res.Width = roundInt(float64(m.Width) * factor)
+	res.Height = roundInt(float64(m.Height) * factor)
+	res.Scale *= factor
+	return &res
+}
+
+// FromRotated maps a match from an image created with
+// DualImage.Rotate into the original image, which has the
+// given size.
+//
+// The result keeps its width and height, it is centered
+// on the mapped center of the match, and its Angle is
+// increased by angle.
+// It is rounded to the nearest pixel.
+func (m *Match) FromRotated(angle float64, width, height int) *Match {
+	r := newImageRotation(width, height, angle)
+	return m.mapCenter(r.original, angle)
+}
+
+// ToRotated is the inverse of FromRotated.
+// It maps a match from an image of the given size into
+// the image created by rotating it with DualImage.Rotate.
+func (m *Match) ToRotated(angle float64, width, height int) *Match {
+	r := newImageRotation(width, height, angle)
+	return m.mapCenter(r.rotated, -angle)
+}
+
+func (m *Match) mapCenter(f func(x, y float64) (float64, float64), angle float64) *Match {
+	res := *m
+	x, y := f(m.Center())
+	res.X = roundInt(x - float64(m.Width)/2)
+	res.Y = roundInt(y - float64(m.Height)/2)
+	res.Angle += angle
+	return &res
+}
+
+// rotatedIntersection computes the area of the
+// intersection of two rotated matches.
+func rotatedIntersection(m, m1 *Match) float64 {
+	corners := m.Corners()
+	polygon := corners[:]
+	clip := m1.Corners()
+	for i := range clip {
+		polygon = clipPolygon(polygon, clip[i], clip[(i+1)%len(clip)])
+		if len(polygon) == 0 {
+			return 0
+		}
+	}
+	return polygonArea(polygon)
+}
+
+// clipPolygon clips a convex polygon to the half-plane to
+// the right of the directed edge from p1 to p2, which is
+// the inside of a polygon whose corners go clockwise as
+// displayed.
+func clipPolygon(polygon [][2]float64, p1, p2 [2]float64) [][2]float64 {
+	side := func(p [2]float64) float64 {
+		return (p2[0]-p1[0])*(p[1]-p1[1]) - (p2[1]-p1[1])*(p[0]-p1[0])
+	}
+	var res [][2]float64
+	for i, p := range polygon {
+		next := polygon[(i+1)%len(polygon)]
+		s, sNext := side(p), side(next)
+		if s >= 0 {
+			res = append(res, p)
+		}
+		if (s >= 0) != (sNext >= 0) {
+			t := s / (s - sNext)
+			res = append(res, [2]float64{p[0] + t*(next[0]-p[0]), p[1] + t*(next[1]-p[1])})
+		}
+	}
+	return res
+}
+
+func polygonArea(polygon [][2]float64) float64 {
+	var res float64
+	for i, p := range polygon {
+		next := polygon[(i+1)%len(polygon)]
+		res += p[0]*next[1] - next[0]*p[1]
+	}
+	return math.Abs(res) / 2
+}
+
+func roundInt(x float64) int {
+	return int(math.Floor(x + 0.5))
+}
+
+// roundEven rounds halves to the nearest even integer,
+// like OpenCV's cvRound.
+func roundEven(x float64) int {
+	return int(math.RoundToEven(x))
+}
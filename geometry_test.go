@@ -0,0 +1,102 @@
+package haar
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestMatchRect(t *testing.T) {
+	r := image.Rect(3, 4, 13, 24)
+	m := MatchFromRect(r)
+	if m.X != 3 || m.Y != 4 || m.Width != 10 || m.Height != 20 {
+		t.Fatalf("unexpected match %v", m)
+	}
+	if m.Rect() != r || m.Bounds() != r {
+		t.Errorf("unexpected rect %v or bounds %v", m.Rect(), m.Bounds())
+	}
+	if m.Area() != 200 {
+		t.Errorf("unexpected area %d", m.Area())
+	}
+	if x, y := m.Center(); x != 8 || y != 14 {
+		t.Errorf("unexpected center %f,%f", x, y)
+	}
+
+	m.Angle = math.Pi / 2
+	if b := m.Bounds(); b != image.Rect(-2, 9, 18, 19) {
+		t.Errorf("unexpected rotated bounds %v", b)
+	}
+}
+
+func TestMatchIntersectUnion(t *testing.T) {
+	m1 := testMatch(0, 0, 10, 10)
+	m2 := testMatch(5, 2, 10, 10)
+	if r := m1.Intersect(m2); r != image.Rect(5, 2, 10, 10) {
+		t.Errorf("unexpected intersection %v", r)
+	}
+	if r := m1.Union(m2); r != image.Rect(0, 0, 15, 12) {
+		t.Errorf("unexpected union %v", r)
+	}
+	if r := m1.Intersect(testMatch(20, 0, 5, 5)); !r.Empty() {
+		t.Errorf("expected empty intersection but got %v", r)
+	}
+}
+
+func TestMatchScaledAboutCenter(t *testing.T) {
+	m := &Match{X: 10, Y: 20, Width: 10, Height: 20, Score: 3}
+	scaled := m.ScaledAboutCenter(1.5)
+	expected := Match{X: 8, Y: 15, Width: 15, Height: 30, Score: 3}
+	if scaled.X != expected.X || scaled.Y != expected.Y || scaled.Width != expected.Width ||
+		scaled.Height != expected.Height || scaled.Score != expected.Score {
+		t.Errorf("expected %+v got %+v", expected, scaled)
+	}
+	if m.Width != 10 {
+		t.Error("original match was modified")
+	}
+}
+
+func TestMatchClamp(t *testing.T) {
+	bounds := image.Rect(0, 0, 20, 20)
+	if m := testMatch(-5, 15, 10, 10).Clamp(bounds); m.Rect() != image.Rect(0, 15, 5, 20) {
+		t.Errorf("unexpected clamped rect %v", m.Rect())
+	}
+	if m := testMatch(30, 30, 10, 10).Clamp(bounds); m.Area() != 0 {
+		t.Errorf("expected empty match but got %v", m)
+	}
+}
+
+func TestMatchFrames(t *testing.T) {
+	m := &Match{X: 10, Y: 20, Width: 8, Height: 6, Scale: 2}
+	if r := m.Add(image.Pt(3, -4)).Rect(); r != image.Rect(13, 16, 21, 22) {
+		t.Errorf("unexpected translated rect %v", r)
+	}
+	if r := m.Add(image.Pt(3, -4)).Sub(image.Pt(3, -4)).Rect(); r != m.Rect() {
+		t.Errorf("unexpected round trip rect %v", r)
+	}
+
+	scaled := m.Scaled(0.5)
+	if scaled.Rect() != image.Rect(5, 10, 9, 13) || scaled.Scale != 1 {
+		t.Errorf("unexpected scaled match %+v", scaled)
+	}
+}
+
+func TestMatchRotatedFrames(t *testing.T) {
+	// The matches are in a 13x7 image.
+	m := testMatch(2, 1, 4, 2)
+	mapped := m.ToRotated(math.Pi/2, 13, 7)
+	if mapped.Angle != -math.Pi/2 {
+		t.Errorf("unexpected angle %f", mapped.Angle)
+	}
+	expected := &Match{X: 1, Y: 13 - 6, Width: 2, Height: 4}
+	if math.Abs(mapped.IoU(expected)-1) > 1e-8 {
+		t.Errorf("expected %v but got %v", expected, mapped)
+	}
+	if mapped.Bounds() != expected.Rect() {
+		t.Errorf("unexpected bounds %v", mapped.Bounds())
+	}
+
+	back := mapped.FromRotated(math.Pi/2, 13, 7)
+	if back.Rect() != m.Rect() || math.Abs(back.Angle) > 1e-8 {
+		t.Errorf("expected %v but got %v (angle %f)", m, back, back.Angle)
+	}
+}
@@ -1,8 +1,10 @@
 package haar
 
 import (
+	"fmt"
 	"image"
 	"math"
+	"sync"
 )
 
 // An IntegralImage is a grayscale image optimized for
@@ -52,7 +54,7 @@ func BitmapIntegralImage(pixels []float64, width, height int) IntegralImage {
 	}
 
 	res := &sliceIntegralImage{
-		integrals: make([]float64, width*height),
+		integrals: make([]float64, (width+1)*(height+1)),
 		width:     width,
 		height:    height,
 	}
@@ -64,7 +66,7 @@ func BitmapIntegralImage(pixels []float64, width, height int) IntegralImage {
 			aboveLeft := res.IntegralAt(x, y)
 			left := res.IntegralAt(x, y+1)
 			above := res.IntegralAt(x+1, y)
-			res.integrals[idx] = pixel + above + left - aboveLeft
+			res.integrals[(x+1)+(width+1)*(y+1)] = pixel + above + left - aboveLeft
 			idx++
 		}
 	}
@@ -72,6 +74,73 @@ func BitmapIntegralImage(pixels []float64, width, height int) IntegralImage {
 	return res
 }
 
+// An IntegralFormat specifies how the integrals of an
+// image are stored in memory.
+type IntegralFormat int
+
+const (
+	// Float64Integrals stores integrals as float64s.
+	// This is the default format, and it is accurate for
+	// any reasonable image size.
+	Float64Integrals IntegralFormat = iota
+
+	// Float32Integrals stores integrals as float32s,
+	// halving memory usage.
+	// Every integral has a relative error of about 6e-8,
+	// so the absolute error of a rectangle sum grows with
+	// the brightness above and to the left of it.
+	// For a 1000x1000 image, errors in rectangle sums
+	// near the bottom-right corner may reach about 0.03,
+	// which is small compared to most feature values.
+	Float32Integrals
+
+	// Uint32Integrals quantizes pixels to 8 bits and
+	// stores exact integer integrals as uint32s.
+	// Sums of 8-bit pixels fit in 32 bits for images with
+	// up to 16,843,009 pixels (e.g. 4096x4096).
+	// When an image is too large for 32-bit integrals,
+	// 64-bit integrals are used instead.
+	//
+	// Sums of squared pixels would overflow 32 bits for
+	// images larger than about 256x256, so a DualImage
+	// stores them as float32s, like Float32Integrals.
+	// They are only used to normalize windows, so their
+	// rounding errors have little effect on features.
+	Uint32Integrals
+
+	// Uint64Integrals quantizes pixels to 8 bits and
+	// stores exact integer integrals as uint64s.
+	// These never overflow for images that fit in memory.
+	Uint64Integrals
+)
+
+// BitmapIntegralImageFormat is like BitmapIntegralImage,
+// but it stores the integrals in the given format.
+//
+// For the integer formats, pixels are quantized to 8 bits,
+// with 0 mapping to 0 and 1 mapping to 255.
+func BitmapIntegralImageFormat(pixels []float64, width, height int,
+	format IntegralFormat) IntegralImage {
+	if len(pixels) != width*height {
+		panic("invalid bitmap size")
+	}
+	switch format {
+	case Float64Integrals:
+		return BitmapIntegralImage(pixels, width, height)
+	case Float32Integrals:
+		return float32IntegralImageFromBitmap(pixels, width, height)
+	case Uint32Integrals, Uint64Integrals:
+		levels := make([]uint32, len(pixels))
+		for i, pixel := range pixels {
+			levels[i] = quantizePixel(pixel)
+		}
+		return integerIntegralImage(levels, width, height, pixelLevels,
+			format == Uint64Integrals || pixelLevels*uint64(len(levels)) > math.MaxUint32)
+	default:
+		panic(fmt.Sprintf("unknown integral format: %d", format))
+	}
+}
+
 // ScaleIntegralImage creates an IntegralImage that
 // approximates a scaled version of img.
 func ScaleIntegralImage(img IntegralImage, width, height int) IntegralImage {
@@ -100,13 +169,47 @@ type DualImage struct {
 	// computed by squaring the brightness values
 	// in Image.
 	squared IntegralImage
+
+	format IntegralFormat
+
+	// tilted stores the tilted integrals of the image.
+	// It is computed the first time a tilted feature is
+	// evaluated on the image.
+	tilted     *tiltedTable
+	tiltedOnce sync.Once
 }
 
 // NewDualImage creates a DualImage based on the data
 // in an IntegralImage.
 func NewDualImage(img IntegralImage) *DualImage {
+	return NewDualImageFormat(img, Float64Integrals)
+}
+
+// NewDualImageFormat is like NewDualImage, but it stores
+// the integrals in the given format.
+func NewDualImageFormat(img IntegralImage, format IntegralFormat) *DualImage {
+	return dualImageFromBitmap(imagePixels(img), img.Width(), img.Height(), format)
+}
+
+// BitmapDualImage creates a DualImage directly from a
+// grayscale bitmap, like BitmapIntegralImage, storing the
+// integrals in the given format.
+//
+// This is cheaper and more accurate than creating an
+// IntegralImage first and passing it to
+// NewDualImageFormat.
+func BitmapDualImage(pixels []float64, width, height int,
+	format IntegralFormat) *DualImage {
+	if len(pixels) != width*height {
+		panic("invalid bitmap size")
+	}
+	return dualImageFromBitmap(pixels, width, height, format)
+}
+
+// imagePixels computes the pixels of an image from its
+// integrals.
+func imagePixels(img IntegralImage) []float64 {
 	bitmap := make([]float64, img.Width()*img.Height())
-	squaredBmp := make([]float64, img.Width()*img.Height())
 
 	var idx int
 	for y := 0; y < img.Height(); y++ {
@@ -114,17 +217,64 @@ func NewDualImage(img IntegralImage) *DualImage {
 			brightness := img.IntegralAt(x+1, y+1) + img.IntegralAt(x, y) -
 				(img.IntegralAt(x, y+1) + img.IntegralAt(x+1, y))
 			bitmap[idx] = brightness
-			squaredBmp[idx] = brightness * brightness
 			idx++
 		}
 	}
 
+	return bitmap
+}
+
+func dualImageFromBitmap(bitmap []float64, width, height int,
+	format IntegralFormat) *DualImage {
+	switch format {
+	case Uint32Integrals:
+		levels := make([]uint32, len(bitmap))
+		squaredBmp := make([]float64, len(bitmap))
+		for i, pixel := range bitmap {
+			level := quantizePixel(pixel)
+			levels[i] = level
+			brightness := float64(level) / pixelLevels
+			squaredBmp[i] = brightness * brightness
+		}
+		return &DualImage{
+			image: integerIntegralImage(levels, width, height, pixelLevels,
+				pixelLevels*uint64(len(bitmap)) > math.MaxUint32),
+			squared: float32IntegralImageFromBitmap(squaredBmp, width, height),
+			format:  format,
+		}
+	case Uint64Integrals:
+		levels := make([]uint32, len(bitmap))
+		squaredLevels := make([]uint32, len(bitmap))
+		for i, pixel := range bitmap {
+			level := quantizePixel(pixel)
+			levels[i] = level
+			squaredLevels[i] = level * level
+		}
+		return &DualImage{
+			image: integerIntegralImage(levels, width, height, pixelLevels, true),
+			squared: integerIntegralImage(squaredLevels, width, height,
+				pixelLevels*pixelLevels, true),
+			format: format,
+		}
+	}
+
+	squaredBmp := make([]float64, len(bitmap))
+	for i, pixel := range bitmap {
+		squaredBmp[i] = pixel * pixel
+	}
 	return &DualImage{
-		image:   BitmapIntegralImage(bitmap, img.Width(), img.Height()),
-		squared: BitmapIntegralImage(squaredBmp, img.Width(), img.Height()),
+		image:   BitmapIntegralImageFormat(bitmap, width, height, format),
+		squared: BitmapIntegralImageFormat(squaredBmp, width, height, format),
+		format:  format,
 	}
 }
 
+// Format returns the format in which the image stores
+// its integrals.
+func (d *DualImage) Format() IntegralFormat {
+	return d.format
+}
+
 // Width returns the width of the underlying image.
 func (d *DualImage) Width() int {
 	return d.image.Width()
@@ -158,13 +308,100 @@ func (d *DualImage) Window(x, y, width, height int) IntegralImage {
 		h:      height,
 		mean:   mean,
 		stddev: math.Sqrt(squareSum/area - math.Pow(mean, 2)),
+		dual:   d,
 	}
 }
 
+// tiltedTable returns the tilted integrals of the image,
+// computing them if necessary.
+//
+// Tilted integrals are always stored as float64s,
+// regardless of the image's format.
+func (d *DualImage) tiltedTable() *tiltedTable {
+	d.tiltedOnce.Do(func() {
+		d.tilted = newTiltedTable(imagePixels(d.image), d.Width(), d.Height())
+	})
+	return d.tilted
+}
+
+// Resize creates a resampled copy of the image with the
+// given dimensions.
+//
+// Each pixel in the new image is the average of the area
+// of the original image which it covers, making this
+// suitable for building image pyramids.
+//
+// The new image uses the same IntegralFormat as d.
+func (d *DualImage) Resize(width, height int) *DualImage {
+	return d.resize(width, height, d.format)
+}
+
+// resize is like Resize, but the new image uses the given
+// format.
+func (d *DualImage) resize(width, height int, format IntegralFormat) *DualImage {
+	xScale := float64(d.Width()) / float64(width)
+	yScale := float64(d.Height()) / float64(height)
+	area := xScale * yScale
+
+	bitmap := make([]float64, width*height)
+
+	var idx int
+	for y := 0; y < height; y++ {
+		minY, maxY := float64(y)*yScale, float64(y+1)*yScale
+		for x := 0; x < width; x++ {
+			minX, maxX := float64(x)*xScale, float64(x+1)*xScale
+			sum := interpolatedIntegral(d.image, maxX, maxY) +
+				interpolatedIntegral(d.image, minX, minY) -
+				(interpolatedIntegral(d.image, minX, maxY) +
+					interpolatedIntegral(d.image, maxX, minY))
+			bitmap[idx] = sum / area
+			idx++
+		}
+	}
+
+	return dualImageFromBitmap(bitmap, width, height, format)
+}
+
+// interpolatedIntegral computes the integral of an image
+// at a fractional coordinate.
+//
+// Since pixels are constant over their area, the integral
+// is bilinear between integer coordinates, making the
+// interpolation exact.
+func interpolatedIntegral(img IntegralImage, x, y float64) float64 {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fracX, fracY := x-x0, y-y0
+	intX, intY := int(x0), int(y0)
+	if intX >= img.Width() {
+		intX, fracX = img.Width(), 0
+	}
+	if intY >= img.Height() {
+		intY, fracY = img.Height(), 0
+	}
+
+	res := img.IntegralAt(intX, intY) * (1 - fracX) * (1 - fracY)
+	if fracX != 0 {
+		res += img.IntegralAt(intX+1, intY) * fracX * (1 - fracY)
+	}
+	if fracY != 0 {
+		res += img.IntegralAt(intX, intY+1) * (1 - fracX) * fracY
+	}
+	if fracX != 0 && fracY != 0 {
+		res += img.IntegralAt(intX+1, intY+1) * fracX * fracY
+	}
+	return res
+}
+
+// A sliceIntegralImage stores the integrals of an image
+// in a flat slice, including a row and column of zeros
+// along the top and left edges.
 type sliceIntegralImage struct {
 	integrals []float64
 	width     int
 	height    int
+
+	tilted     *tiltedTable
+	tiltedOnce sync.Once
 }
 
 func (s *sliceIntegralImage) Width() int {
@@ -179,7 +416,32 @@ func (s *sliceIntegralImage) IntegralAt(x, y int) float64 {
 	if x <= 0 || y <= 0 {
 		return 0
 	}
-	return s.integrals[(x-1)+s.width*(y-1)]
+	return s.integrals[x+(s.width+1)*y]
+}
+
+func (s *sliceIntegralImage) TiltedIntegralAt(x, y int) float64 {
+	s.tiltedOnce.Do(func() {
+		s.tilted = newTiltedTable(imagePixels(s), s.width, s.height)
+	})
+	return s.tilted.at(x, y)
+}
+
+// paddedIntegrals returns the integrals of an image as a
+// flat slice with (width+1)*(height+1) entries, where the
+// entry at x+(width+1)*y is the integral at (x, y).
+func paddedIntegrals(img IntegralImage) []float64 {
+	if s, ok := img.(*sliceIntegralImage); ok {
+		return s.integrals
+	}
+	res := make([]float64, (img.Width()+1)*(img.Height()+1))
+	var idx int
+	for y := 0; y <= img.Height(); y++ {
+		for x := 0; x <= img.Width(); x++ {
+			res[idx] = img.IntegralAt(x, y)
+			idx++
+		}
+	}
+	return res
 }
 
 type croppedImage struct {
@@ -191,6 +453,9 @@ type croppedImage struct {
 
 	mean   float64
 	stddev float64
+
+	// dual is the image which img belongs to.
+	dual *DualImage
 }
 
 func (c *croppedImage) Width() int {
@@ -207,6 +472,17 @@ func (c *croppedImage) IntegralAt(x, y int) float64 {
 	return (rawVal - area*c.mean) / c.stddev
 }
 
+func (c *croppedImage) TiltedIntegralAt(x, y int) float64 {
+	// Every row of a tilted triangle above the bottom row
+	// is two pixels wider than the next, so the triangle
+	// contains y*y pixels if it is not clipped.
+	// Clipping does not affect the number of pixels in a
+	// rotated rectangle computed from these triangles.
+	area := float64((y + c.y) * (y + c.y))
+	rawVal := c.dual.tiltedTable().at(x+c.x, y+c.y)
+	return (rawVal - area*c.mean) / c.stddev
+}
+
 type scaledImage struct {
 	img       IntegralImage
 	newWidth  int
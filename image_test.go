@@ -75,6 +75,125 @@ func TestDualImage(t *testing.T) {
 	}
 }
 
+func TestDualImageResize(t *testing.T) {
+	bmp := BitmapIntegralImage(imageTestBitmap, imageTestBitmapWidth,
+		imageTestBitmapHeight)
+	dual := NewDualImage(bmp)
+
+	sizes := [][2]int{{7, 7}, {3, 3}, {2, 5}, {4, 1}, {10, 8}}
+	for _, size := range sizes {
+		width, height := size[0], size[1]
+		resized := dual.Resize(width, height)
+		if resized.Width() != width || resized.Height() != height {
+			t.Errorf("expected size %dx%d got %dx%d", width, height, resized.Width(),
+				resized.Height())
+			continue
+		}
+		xScale := float64(imageTestBitmapWidth) / float64(width)
+		yScale := float64(imageTestBitmapHeight) / float64(height)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				var expected float64
+				for srcY := 0; srcY < imageTestBitmapHeight; srcY++ {
+					overlapY := imageTestOverlap(srcY, float64(y)*yScale, float64(y+1)*yScale)
+					for srcX := 0; srcX < imageTestBitmapWidth; srcX++ {
+						overlapX := imageTestOverlap(srcX, float64(x)*xScale,
+							float64(x+1)*xScale)
+						expected += overlapX * overlapY *
+							imageTestBitmap[srcX+srcY*imageTestBitmapWidth]
+					}
+				}
+				expected /= xScale * yScale
+				actual := rectangleSum(resized.image, x, y, 1, 1)
+				if math.Abs(actual-expected) > 1e-5 {
+					t.Errorf("%dx%d: pixel at %d,%d should be %f but it's %f", width,
+						height, x, y, expected, actual)
+				}
+				squared := rectangleSum(resized.squared, x, y, 1, 1)
+				if math.Abs(squared-expected*expected) > 1e-5 {
+					t.Errorf("%dx%d: squared pixel at %d,%d should be %f but it's %f",
+						width, height, x, y, expected*expected, squared)
+				}
+			}
+		}
+	}
+}
+
+func TestIntegralFormats(t *testing.T) {
+	quantized := make([]float64, len(imageTestBitmap))
+	for i, x := range imageTestBitmap {
+		quantized[i] = math.Floor(x*255+0.5) / 255
+	}
+	exact := NewDualImage(BitmapIntegralImage(imageTestBitmap, imageTestBitmapWidth,
+		imageTestBitmapHeight))
+	exactQuantized := NewDualImage(BitmapIntegralImage(quantized, imageTestBitmapWidth,
+		imageTestBitmapHeight))
+
+	formats := []IntegralFormat{Float64Integrals, Float32Integrals, Uint32Integrals,
+		Uint64Integrals}
+	for _, format := range formats {
+		expected := exact
+		if format == Uint32Integrals || format == Uint64Integrals {
+			expected = exactQuantized
+		}
+		bmp := BitmapIntegralImageFormat(imageTestBitmap, imageTestBitmapWidth,
+			imageTestBitmapHeight, format)
+		dual := NewDualImageFormat(bmp, format)
+		if dual.Format() != format {
+			t.Errorf("format %d: got format %d", format, dual.Format())
+		}
+		direct := BitmapDualImage(imageTestBitmap, imageTestBitmapWidth,
+			imageTestBitmapHeight, format)
+		if direct.Format() != format {
+			t.Errorf("format %d: got format %d from bitmap", format, direct.Format())
+		}
+		for y := 0; y <= imageTestBitmapHeight; y++ {
+			for x := 0; x <= imageTestBitmapWidth; x++ {
+				for _, pair := range [][2]IntegralImage{{expected.image, dual.image},
+					{expected.squared, dual.squared}, {expected.image, direct.image},
+					{expected.squared, direct.squared}} {
+					e, a := pair[0].IntegralAt(x, y), pair[1].IntegralAt(x, y)
+					if math.Abs(e-a) > 1e-5 {
+						t.Errorf("format %d: at %d,%d expected %f got %f", format, x, y, e, a)
+					}
+				}
+			}
+		}
+		expectedWindow := expected.Window(1, 2, 5, 4)
+		actualWindow := dual.Window(1, 2, 5, 4)
+		for y := 0; y <= 4; y++ {
+			for x := 0; x <= 5; x++ {
+				e, a := expectedWindow.IntegralAt(x, y), actualWindow.IntegralAt(x, y)
+				if math.Abs(e-a) > 1e-4 {
+					t.Errorf("format %d: window at %d,%d expected %f got %f", format, x, y,
+						e, a)
+				}
+			}
+		}
+	}
+}
+
+func TestIntegralFormatOverflow(t *testing.T) {
+	pixels := make([]float64, 300*300)
+	for i := range pixels {
+		pixels[i] = 1
+	}
+	dual := NewDualImageFormat(BitmapIntegralImage(pixels, 300, 300), Uint32Integrals)
+	if _, ok := dual.image.(*uint32IntegralImage); !ok {
+		t.Error("expected 32-bit integrals for image")
+	}
+	if _, ok := dual.squared.(*float32IntegralImage); !ok {
+		t.Error("expected float32 integrals for squared image")
+	}
+	if actual := dual.squared.IntegralAt(300, 300); math.Abs(actual-300*300) > 1e-2 {
+		t.Errorf("expected squared integral %d but got %f", 300*300, actual)
+	}
+}
+
+func imageTestOverlap(pixel int, start, end float64) float64 {
+	return math.Max(0, math.Min(float64(pixel+1), end)-math.Max(float64(pixel), start))
+}
+
 func imageTestIntegral(x, y int) float64 {
 	var sum float64
 	for stepX := 0; stepX < x; stepX++ {
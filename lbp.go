@@ -0,0 +1,139 @@
+package haar
+
+// LBPFeatureKind is the kind of LBPFeature.
+const LBPFeatureKind = "mblbp"
+
+// LBPCodes is the number of codes an LBPFeature can
+// produce.
+const LBPCodes = 256
+
+func init() {
+	RegisterFeature(LBPFeatureKind, func() WindowFeature {
+		return &LBPFeature{}
+	})
+}
+
+// A CategoricalFeature is a WindowFeature whose values
+// are integers from 0 to NumCategories()-1.
+//
+// Lookup tables for categorical features have one bin
+// per category, regardless of Requirements.Bins.
+type CategoricalFeature interface {
+	WindowFeature
+
+	NumCategories() int
+}
+
+// An LBPFeature is a Multi-Block Local Binary Pattern.
+//
+// The feature is a 3x3 grid of cells.
+// Its value is an 8-bit code with one bit for each outer
+// cell, which is set if the cell's sum is at least the
+// sum of the center cell.
+// The bits start with the top-left cell as the highest
+// bit and proceed clockwise.
+//
+// Since the code only depends on comparisons, it is not
+// affected by the brightness or contrast of a window.
+// LBP features are meant to be used with lookup tables,
+// by training with RealAdaBoost or GentleAdaBoost.
+type LBPFeature struct {
+	// X and Y are the top-left corner of the grid.
+	X int
+	Y int
+
+	// CellWidth and CellHeight are the size of each cell,
+	// so the grid is three times as large.
+	CellWidth  int
+	CellHeight int
+
+	// Mirrored indicates that the bits proceed
+	// counterclockwise from the top-right cell.
+	// This way, a mirrored feature gives the same code on
+	// a mirrored window as the original feature gives on
+	// the original window.
+	Mirrored bool `json:",omitempty"`
+}
+
+// AllLBPFeatures builds a list of every LBP feature that
+// fits in the given window size.
+//
+// The features are returned as WindowFeatures so that
+// they can be passed directly to TrainFeatures.
+func AllLBPFeatures(width, height int) []WindowFeature {
+	var res []WindowFeature
+	for w := 1; w*3 <= width; w++ {
+		for h := 1; h*3 <= height; h++ {
+			for x := 0; x+w*3 <= width; x++ {
+				for y := 0; y+h*3 <= height; y++ {
+					res = append(res, &LBPFeature{X: x, Y: y, CellWidth: w, CellHeight: h})
+				}
+			}
+		}
+	}
+	return res
+}
+
+// Value computes the feature's code on the given window.
+func (l *LBPFeature) Value(img IntegralImage) float64 {
+	var integrals [4][4]float64
+	for i := range integrals {
+		for j := range integrals[i] {
+			integrals[i][j] = img.IntegralAt(l.X+j*l.CellWidth, l.Y+i*l.CellHeight)
+		}
+	}
+	cellSum := func(x, y int) float64 {
+		return integrals[y+1][x+1] + integrals[y][x] - (integrals[y][x+1] + integrals[y+1][x])
+	}
+
+	center := cellSum(1, 1)
+	var code int
+	for _, cell := range [8][2]int{{0, 0}, {1, 0}, {2, 0}, {2, 1}, {2, 2}, {1, 2}, {0, 2},
+		{0, 1}} {
+		if l.Mirrored {
+			cell[0] = 2 - cell[0]
+		}
+		code <<= 1
+		if cellSum(cell[0], cell[1]) >= center {
+			code |= 1
+		}
+	}
+	return float64(code)
+}
+
+// Kind returns LBPFeatureKind.
+func (l *LBPFeature) Kind() string {
+	return LBPFeatureKind
+}
+
+// NumCategories returns LBPCodes.
+func (l *LBPFeature) NumCategories() int {
+	return LBPCodes
+}
+
+// MirroredFeature creates the mirror image of the
+// feature, which gives the same codes on mirrored windows
+// by toggling Mirrored.
+// The sign is always 1.
+func (l *LBPFeature) MirroredFeature(windowWidth int) (feature WindowFeature, sign float64) {
+	res := *l
+	res.X = windowWidth - (l.X + l.CellWidth*3)
+	res.Mirrored = !l.Mirrored
+	return &res, 1
+}
+
+// ScaledFeature is like Feature.Scaled.
+// Since codes do not depend on the area of the cells,
+// areaScale is always 1.
+func (l *LBPFeature) ScaledFeature(xScale, yScale float64, windowWidth,
+	windowHeight int) (feature WindowFeature, areaScale float64) {
+	width := scaleFeatureSize(l.CellWidth*3, xScale, 3, windowWidth)
+	height := scaleFeatureSize(l.CellHeight*3, yScale, 3, windowHeight)
+	return &LBPFeature{
+		X:          scaleFeatureCoord(l.X, xScale, width, windowWidth),
+		Y:          scaleFeatureCoord(l.Y, yScale, height, windowHeight),
+		CellWidth:  width / 3,
+		CellHeight: height / 3,
+		Mirrored:   l.Mirrored,
+	}, 1
+}
@@ -0,0 +1,185 @@
+package haar
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestLBPFeatureValue(t *testing.T) {
+	img := featureTestImage()
+	for _, feature := range AllLBPFeatures(imageTestBitmapWidth, imageTestBitmapHeight) {
+		f := feature.(*LBPFeature)
+		cellSum := func(cx, cy int) float64 {
+			var sum float64
+			for y := 0; y < f.CellHeight; y++ {
+				for x := 0; x < f.CellWidth; x++ {
+					px := f.X + cx*f.CellWidth + x
+					py := f.Y + cy*f.CellHeight + y
+					sum += imageTestBitmap[px+py*imageTestBitmapWidth]
+				}
+			}
+			return sum
+		}
+		var expected int
+		neighbors := [][2]int{{0, 0}, {1, 0}, {2, 0}, {2, 1}, {2, 2}, {1, 2}, {0, 2}, {0, 1}}
+		for i, cell := range neighbors {
+			if cellSum(cell[0], cell[1]) >= cellSum(1, 1) {
+				expected |= 1 << uint(7-i)
+			}
+		}
+		if actual := f.Value(img); actual != float64(expected) {
+			t.Errorf("feature %v: expected %d got %f", *f, expected, actual)
+		}
+	}
+}
+
+func TestAllLBPFeatures(t *testing.T) {
+	features := AllLBPFeatures(7, 6)
+	// Cell widths 1 and 2 give 5 and 2 positions, and
+	// cell heights 1 and 2 give 4 and 1 positions.
+	if len(features) != (5+2)*(4+1) {
+		t.Errorf("unexpected feature count: %d", len(features))
+	}
+	for _, feature := range features {
+		f := feature.(*LBPFeature)
+		if f.X+3*f.CellWidth > 7 || f.Y+3*f.CellHeight > 6 {
+			t.Errorf("feature out of bounds: %v", *f)
+		}
+	}
+}
+
+func TestLBPFeatureScaled(t *testing.T) {
+	f := &LBPFeature{X: 1, Y: 2, CellWidth: 2, CellHeight: 1}
+	scaled, areaScale := f.ScaledFeature(2, 3, 20, 20)
+	expected := LBPFeature{X: 2, Y: 6, CellWidth: 4, CellHeight: 3}
+	if *scaled.(*LBPFeature) != expected || areaScale != 1 {
+		t.Errorf("unexpected scaled feature %v (area scale %f)", scaled, areaScale)
+	}
+	scaled, _ = f.ScaledFeature(10, 10, 20, 20)
+	if s := scaled.(*LBPFeature); s.X+3*s.CellWidth > 20 || s.Y+3*s.CellHeight > 20 {
+		t.Errorf("scaled feature out of bounds: %v", *s)
+	}
+}
+
+func TestTrainLBPLayer(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	var pos, neg []IntegralImage
+	for i := 0; i < 60; i++ {
+		pos = append(pos, boostTestSample(gen, true))
+		neg = append(neg, boostTestSample(gen, false))
+	}
+	reqs := &Requirements{
+		PositiveRetention: 0.95,
+		NegativeExclusion: 0.9,
+		MaxFeatures:       10,
+		Boosting:          GentleAdaBoost,
+	}
+	layer := trainLayer(reqs, pos, neg, AllLBPFeatures(6, 6), nil)
+	if len(layer.Tables) != len(layer.Features) {
+		t.Fatalf("expected %d tables got %d", len(layer.Features), len(layer.Tables))
+	}
+	for i, table := range layer.Tables {
+		if len(table.Values) != LBPCodes {
+			t.Errorf("expected %d bins got %d", LBPCodes, len(table.Values))
+		}
+		if _, ok := layer.Features[i].(*LBPFeature); !ok {
+			t.Errorf("unexpected feature: %v", layer.Features[i])
+		}
+	}
+
+	var excluded int
+	for _, x := range neg {
+		if !layer.Classify(x) {
+			excluded++
+		}
+	}
+	if exc := float64(excluded) / float64(len(neg)); exc < reqs.NegativeExclusion {
+		t.Errorf("bad exclusion %f", exc)
+	}
+
+	data, err := json.Marshal(layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Layer
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	for i, x := range append(pos[:10:10], neg[:10]...) {
+		if decoded.Sum(x) != layer.Sum(x) {
+			t.Errorf("sample %d: decoded sum %f but expected %f", i, decoded.Sum(x),
+				layer.Sum(x))
+		}
+	}
+}
+
+func TestTrainLBPLayerDiscrete(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	var pos, neg []IntegralImage
+	for i := 0; i < 60; i++ {
+		pos = append(pos, boostTestSample(gen, true))
+		neg = append(neg, boostTestSample(gen, false))
+	}
+	for _, depth := range []int{0, 2} {
+		reqs := &Requirements{
+			PositiveRetention: 0.95,
+			NegativeExclusion: 0.9,
+			MaxFeatures:       10,
+			TreeDepth:         depth,
+		}
+		layer := trainLayer(reqs, pos, neg, AllLBPFeatures(6, 6), nil)
+		if len(layer.Tables) != len(layer.Features) || layer.Trees != nil {
+			t.Errorf("depth %d: expected lookup tables for LBP features", depth)
+		}
+		if reqs.Boosting != DiscreteAdaBoost || reqs.TreeDepth != depth {
+			t.Error("requirements were modified")
+		}
+	}
+}
+
+func TestLBPCascadeScan(t *testing.T) {
+	cascade := &Cascade{
+		WindowWidth:  8,
+		WindowHeight: 8,
+		Layers: []*Layer{
+			{
+				Features: []WindowFeature{
+					&LBPFeature{X: 1, Y: 1, CellWidth: 2, CellHeight: 2},
+					&LBPFeature{X: 0, Y: 2, CellWidth: 1, CellHeight: 2},
+				},
+				Thresholds: []float64{0, 0},
+				Weights:    []float64{1, 0.5},
+				Tables:     []*LookupTable{lbpTestTable(1), lbpTestTable(2)},
+				Threshold:  -0.2,
+			},
+		},
+	}
+	img := NewDualImage(scanTestImage(70, 50, 4))
+	opts := &ScanOptions{Scale: 1.1, StrideX: 1.5}
+	expected, _ := cascade.ScanWithOptions(context.Background(), img, opts)
+	if len(expected) == 0 {
+		t.Fatal("expected some matches")
+	}
+	compiled, _ := cascade.Compile().ScanWithOptions(context.Background(), img, opts)
+	if len(compiled) != len(expected) {
+		t.Fatalf("expected %d compiled matches got %d", len(expected), len(compiled))
+	}
+	for i, x := range expected {
+		a := compiled[i]
+		if x.X != a.X || x.Y != a.Y || x.Width != a.Width || math.Abs(x.Score-a.Score) > 1e-8 {
+			t.Errorf("match %d: expected %v got %v", i, x, a)
+		}
+	}
+}
+
+func lbpTestTable(seed int64) *LookupTable {
+	gen := rand.New(rand.NewSource(seed))
+	table := &LookupTable{Min: -0.5, Max: LBPCodes - 0.5, Values: make([]float64, LBPCodes)}
+	for i := range table.Values {
+		table.Values[i] = gen.Float64()*2 - 1
+	}
+	return table
+}
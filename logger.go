@@ -21,7 +21,7 @@ type Logger interface {
 	// The retention and exclusion arguments indicate the
 	// positive retention rate and the negative exclusion
 	// rate, respectively.
-	LogFeature(numFeatures int, retention, exclusion float64, f *Feature)
+	LogFeature(numFeatures int, retention, exclusion float64, f WindowFeature)
 }
 
 // A ConsoleLogger logs output using the log package.
@@ -35,7 +35,12 @@ func (_ ConsoleLogger) LogCreatedNegatives(count int) {
 	log.Printf("Created %d negatives.", count)
 }
 
-func (_ ConsoleLogger) LogFeature(numFeatures int, retention, exclusion float64, f *Feature) {
-	log.Printf("Feature %d: retention=%f exclusion=%f type=%d", numFeatures,
-		retention, exclusion, f.Type)
+func (_ ConsoleLogger) LogFeature(numFeatures int, retention, exclusion float64, f WindowFeature) {
+	if haarFeature, ok := f.(*Feature); ok {
+		log.Printf("Feature %d: retention=%f exclusion=%f type=%d", numFeatures,
+			retention, exclusion, haarFeature.Type)
+	} else {
+		log.Printf("Feature %d: retention=%f exclusion=%f kind=%s", numFeatures,
+			retention, exclusion, f.Kind())
+	}
 }
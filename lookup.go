@@ -0,0 +1,62 @@
+package haar
+
+import "math"
+
+// A LookupTable maps feature values to real-valued
+// outputs.
+//
+// The range from Min to Max is split into len(Values)
+// bins of equal size.
+// Values below Min go in the first bin, and values above
+// Max go in the last bin.
+type LookupTable struct {
+	Min    float64
+	Max    float64
+	Values []float64
+}
+
+// Bin returns the index of the bin for a feature value.
+func (l *LookupTable) Bin(value float64) int {
+	if !(l.Max > l.Min) {
+		return 0
+	}
+	bin := int(math.Floor((value - l.Min) / (l.Max - l.Min) * float64(len(l.Values))))
+	if bin < 0 {
+		return 0
+	} else if bin >= len(l.Values) {
+		return len(l.Values) - 1
+	}
+	return bin
+}
+
+// Lookup returns the output for a feature value.
+func (l *LookupTable) Lookup(value float64) float64 {
+	return l.Values[l.Bin(value)]
+}
+
+// maxOutput returns the maximum absolute value in the
+// table.
+func (l *LookupTable) maxOutput() float64 {
+	var res float64
+	for _, x := range l.Values {
+		res = math.Max(res, math.Abs(x))
+	}
+	return res
+}
+
+func (l *LookupTable) copy() *LookupTable {
+	return &LookupTable{
+		Min:    l.Min,
+		Max:    l.Max,
+		Values: append([]float64{}, l.Values...),
+	}
+}
+
+// scaled creates a table for feature values which have
+// been divided by areaScale.
+func (l *LookupTable) scaled(areaScale float64) *LookupTable {
+	res := l.copy()
+	res.Min /= areaScale
+	res.Max /= areaScale
+	return res
+}
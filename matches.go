@@ -12,6 +12,44 @@ type Match struct {
 	Y      int
 	Width  int
 	Height int
+
+	// Score indicates how confident the cascade was in
+	// the match.
+	// For raw matches, it is the amount by which the
+	// final layer's sum exceeded its threshold.
+	// For joined matches, it is the highest score of
+	// the joined matches.
+	Score float64
+
+	// LayerSums contains the sum from every layer of the
+	// cascade when run on the matching window.
+	// For joined matches, it is the average of the sums
+	// from the joined matches.
+	LayerSums []float64
+
+	// Scale is the factor by which the cascade's window
+	// was scaled to produce the match.
+	// For joined matches, it is the average scale.
+	Scale float64
+
+	// Count is the number of raw matches which make up
+	// this match.
+	// Raw matches from a scan have a count of 1.
+	Count int
+
+	// Mirrored is set for matches of a mirrored cascade
+	// found by Cascade.ScanMirrored.
+	// For joined matches, it is taken from the match with
+	// the highest score.
+	Mirrored bool
+
+	// Angle is the in-plane rotation of the match, in
+	// radians, as found by ScanRotated.
+	// The match covers the rectangle given by X, Y, Width,
+	// and Height, rotated clockwise (as displayed) about
+	// its center by Angle.
+	// For joined matches, it is the average angle.
+	Angle float64
 }
 
 // String returns a human readable version of the
@@ -24,44 +62,15 @@ func (m *Match) String() string {
 // match rectangles.
 // The overlap is the fraction of the smaller match
 // that is covered by the other match.
+//
+// If either match has an Angle, the overlap is computed
+// between the rotated rectangles.
 func (m *Match) Overlap(m1 *Match) float64 {
-	if m.X >= m1.X+m1.Width || m.X+m.Width <= m1.X ||
-		m.Y >= m1.Y+m1.Height || m.Y+m.Height <= m1.Y {
+	intersection := m.intersection(m1)
+	if intersection == 0 {
 		return 0
 	}
-
-	var minX, maxX int
-	if m.X < m1.X {
-		minX = m1.X
-	} else {
-		minX = m.X
-	}
-	if m.X+m.Width < m1.X+m1.Width {
-		maxX = m.X + m.Width
-	} else {
-		maxX = m1.X + m1.Width
-	}
-
-	var minY, maxY int
-	if m.Y < m1.Y {
-		minY = m1.Y
-	} else {
-		minY = m.Y
-	}
-	if m.Y+m.Height < m1.Y+m1.Height {
-		maxY = m.Y + m.Height
-	} else {
-		maxY = m1.Y + m1.Height
-	}
-
-	area := float64((maxX - minX) * (maxY - minY))
-	if m.Width*m.Height > m1.Width*m1.Height {
-		area /= float64(m1.Width * m1.Height)
-	} else {
-		area /= float64(m.Width * m.Height)
-	}
-
-	return area
+	return math.Min(1, intersection/math.Min(float64(m.Area()), float64(m1.Area())))
 }
 
 // Matches is a slice of (possibly overlapping) matches.
@@ -77,56 +86,185 @@ func (m Matches) MaxOverlap(m1 *Match) float64 {
 	return max
 }
 
-// Unique produces a list of matches in which overlapping
-// matches have been averaged together into one match.
+// JoinOverlaps produces a list of matches in which
+// overlapping matches have been averaged together into
+// one match.
 //
 // The threshold argument specifies how much overlap two
 // matches must have between they are merged.
 // Any overlap greater than threshold is considered enough
 // to merge two images.
 // An overlap of 0 joins any regions which overlap at all.
+//
+// Each joined match carries the aggregate score and the
+// total count of the matches it was made from.
+//
+// See JoinOverlapsMetric, WeightedJoinOverlaps, and
+// NonMaxSuppression for other ways to merge matches.
 func (m Matches) JoinOverlaps(threshold float64) Matches {
-	var clusters []Matches
+	return m.JoinOverlapsMetric(threshold, SmallerAreaOverlap)
+}
 
-	for _, match := range m {
-		var overlaps []int
-		for i, cluster := range clusters {
-			if cluster.MaxOverlap(match) > threshold {
-				overlaps = append(overlaps, i)
+// DefaultGroupEpsilon is the similarity epsilon which
+// OpenCV uses by default for grouping rectangles.
+const DefaultGroupEpsilon = 0.2
+
+// GroupRectangles groups similar matches like OpenCV's
+// groupRectangles.
+//
+// Two matches are similar if each of their edges differ
+// by at most eps times the average of their smaller width
+// and smaller height.
+// Similarity is transitive, so a group contains every
+// match which is connected to it through similar matches.
+// Each group is averaged into one match, with coordinates
+// rounded like OpenCV's cvRound, so halves are rounded to
+// the nearest even integer.
+// The Count of a grouped match is the number of matches
+// in its group, regardless of the counts of those
+// matches.
+//
+// Groups made of minNeighbors or fewer matches are
+// dropped.
+// Then, a group is dropped if it lies within a bigger
+// group (enlarged by eps times its size) which has more
+// than max(3, n) matches, where n is the size of the
+// smaller group, or if n is less than 3.
+//
+// As in OpenCV, if minNeighbors is 0 or less, the matches
+// are returned without grouping.
+func (m Matches) GroupRectangles(minNeighbors int, eps float64) Matches {
+	if minNeighbors <= 0 || len(m) == 0 {
+		return append(Matches{}, m...)
+	}
+
+	groups := m.partition(func(m1, m2 *Match) bool {
+		delta := eps * (math.Min(float64(m1.Width), float64(m2.Width)) +
+			math.Min(float64(m1.Height), float64(m2.Height))) / 2
+		return math.Abs(float64(m1.X-m2.X)) <= delta &&
+			math.Abs(float64(m1.Y-m2.Y)) <= delta &&
+			math.Abs(float64(m1.X+m1.Width-(m2.X+m2.Width))) <= delta &&
+			math.Abs(float64(m1.Y+m1.Height-(m2.Y+m2.Height))) <= delta
+	})
+
+	joined := make(Matches, len(groups))
+	for i, group := range groups {
+		joined[i] = group.average()
+		var x, y, width, height int
+		for _, match := range group {
+			x += match.X
+			y += match.Y
+			width += match.Width
+			height += match.Height
+		}
+		n := float64(len(group))
+		joined[i].X = roundEven(float64(x) / n)
+		joined[i].Y = roundEven(float64(y) / n)
+		joined[i].Width = roundEven(float64(width) / n)
+		joined[i].Height = roundEven(float64(height) / n)
+		joined[i].Count = len(group)
+	}
+
+	var res Matches
+GroupLoop:
+	for i, m1 := range joined {
+		n1 := m1.Count
+		if n1 <= minNeighbors {
+			continue
+		}
+		for j, m2 := range joined {
+			n2 := m2.Count
+			if i == j || n2 <= minNeighbors {
+				continue
+			}
+			dx := roundEven(float64(m2.Width) * eps)
+			dy := roundEven(float64(m2.Height) * eps)
+			if m1.X >= m2.X-dx && m1.Y >= m2.Y-dy &&
+				m1.X+m1.Width <= m2.X+m2.Width+dx &&
+				m1.Y+m1.Height <= m2.Y+m2.Height+dy &&
+				(n2 > 3 && n2 > n1 || n1 < 3) {
+				continue GroupLoop
 			}
 		}
-		if len(overlaps) == 0 {
-			clusters = append(clusters, Matches{match})
-		} else {
-			first := overlaps[0]
-			clusters[first] = append(clusters[first], match)
-			for i := len(overlaps) - 1; i > 0; i-- {
-				k := overlaps[i]
-				clusters[first] = append(clusters[first], clusters[k]...)
-				clusters[k] = clusters[len(clusters)-1]
-				clusters = clusters[:len(clusters)-1]
+		res = append(res, m1)
+	}
+	return res
+}
+
+// partition splits the matches into the connected
+// components of the given similarity relation.
+// Components are ordered by their first match.
+func (m Matches) partition(similar func(m1, m2 *Match) bool) []Matches {
+	sets := newUnionFind(len(m))
+	for i, m1 := range m {
+		for j := i + 1; j < len(m); j++ {
+			if similar(m1, m[j]) {
+				sets.Union(i, j)
 			}
 		}
 	}
 
-	res := make(Matches, len(clusters))
-	for i, cluster := range clusters {
-		res[i] = cluster.average()
+	var res []Matches
+	indices := map[int]int{}
+	for i, match := range m {
+		r := sets.Find(i)
+		if idx, ok := indices[r]; ok {
+			res[idx] = append(res[idx], match)
+		} else {
+			indices[r] = len(res)
+			res = append(res, Matches{match})
+		}
 	}
 	return res
 }
 
 func (m Matches) average() *Match {
-	var sum Match
+	sum := Match{Score: math.Inf(-1)}
 	for _, match := range m {
 		sum.X += match.X
 		sum.Y += match.Y
 		sum.Width += match.Width
 		sum.Height += match.Height
+		if match.Score > sum.Score {
+			sum.Score = match.Score
+			sum.Mirrored = match.Mirrored
+		}
+		sum.Scale += match.Scale
+		sum.Angle += match.Angle
+		if match.Count > 0 {
+			sum.Count += match.Count
+		} else {
+			sum.Count++
+		}
 	}
 	sum.X /= len(m)
 	sum.Y /= len(m)
 	sum.Width /= len(m)
 	sum.Height /= len(m)
+	sum.Scale /= float64(len(m))
+	sum.Angle /= float64(len(m))
+	sum.LayerSums = m.averageLayerSums()
 	return &sum
 }
+
+func (m Matches) averageLayerSums() []float64 {
+	numSums := len(m[0].LayerSums)
+	for _, match := range m[1:] {
+		if len(match.LayerSums) != numSums {
+			return nil
+		}
+	}
+	if numSums == 0 {
+		return nil
+	}
+	res := make([]float64, numSums)
+	for _, match := range m {
+		for i, x := range match.LayerSums {
+			res[i] += x
+		}
+	}
+	for i := range res {
+		res[i] /= float64(len(m))
+	}
+	return res
+}
@@ -11,43 +11,68 @@ type matchesTest struct {
 }
 
 func TestMatchOverlap(t *testing.T) {
-	m1 := &Match{10, 10, 30, 20}
-	m2 := &Match{11, 5, 15, 10}
+	m1 := testMatch(10, 10, 30, 20)
+	m2 := testMatch(11, 5, 15, 10)
 	overlap := m1.Overlap(m2)
 	if math.Abs(overlap-75.0/150) > 1e-5 {
 		t.Error("expected overlap of 0.5 but got", overlap)
 	}
 }
 
+func TestJoinOverlapsScores(t *testing.T) {
+	raw := Matches{
+		&Match{X: 0, Y: 0, Width: 10, Height: 10, Score: 1, LayerSums: []float64{2, 4},
+			Scale: 1, Count: 1},
+		&Match{X: 8, Y: 0, Width: 10, Height: 10, Score: 3, LayerSums: []float64{4, 6},
+			Scale: 2, Count: 1},
+		&Match{X: 30, Y: 0, Width: 10, Height: 10, Score: 2, LayerSums: []float64{1, 1},
+			Scale: 1, Count: 1},
+	}
+	joined := raw.JoinOverlaps(0)
+	if len(joined) != 2 {
+		t.Fatalf("expected 2 matches but got %d", len(joined))
+	}
+	if joined[0].Score != 3 || joined[0].Count != 2 || joined[0].Scale != 1.5 {
+		t.Errorf("unexpected joined match: %+v", joined[0])
+	}
+	if len(joined[0].LayerSums) != 2 || joined[0].LayerSums[0] != 3 ||
+		joined[0].LayerSums[1] != 5 {
+		t.Errorf("unexpected joined layer sums: %v", joined[0].LayerSums)
+	}
+	if joined[1].Score != 2 || joined[1].Count != 1 {
+		t.Errorf("unexpected lone match: %+v", joined[1])
+	}
+}
+
 func TestJoinOverlaps(t *testing.T) {
 	tests := []matchesTest{
 		{
-			RawMatches:   Matches{&Match{0, 0, 10, 10}},
-			Consolidated: Matches{&Match{0, 0, 10, 10}},
+			RawMatches:   Matches{testMatch(0, 0, 10, 10)},
+			Consolidated: Matches{testMatch(0, 0, 10, 10)},
 		},
 		{
-			RawMatches:   Matches{&Match{0, 0, 10, 10}, &Match{10, 0, 10, 10}},
-			Consolidated: Matches{&Match{0, 0, 10, 10}, &Match{10, 0, 10, 10}},
+			RawMatches:   Matches{testMatch(0, 0, 10, 10), testMatch(10, 0, 10, 10)},
+			Consolidated: Matches{testMatch(0, 0, 10, 10), testMatch(10, 0, 10, 10)},
 		},
 		{
-			RawMatches:   Matches{&Match{0, 0, 10, 10}, &Match{8, 0, 10, 10}},
-			Consolidated: Matches{&Match{4, 0, 10, 10}},
+			RawMatches:   Matches{testMatch(0, 0, 10, 10), testMatch(8, 0, 10, 10)},
+			Consolidated: Matches{testMatch(4, 0, 10, 10)},
 		},
 		{
 			RawMatches: Matches{
-				&Match{0, 0, 10, 10},
-				&Match{8, 0, 10, 10},
-				&Match{16, 0, 4, 10},
+				testMatch(0, 0, 10, 10),
+				testMatch(8, 0, 10, 10),
+				testMatch(16, 0, 4, 10),
 			},
-			Consolidated: Matches{&Match{8, 0, 8, 10}},
+			Consolidated: Matches{testMatch(8, 0, 8, 10)},
 		},
 		{
 			RawMatches: Matches{
-				&Match{0, 0, 10, 10},
-				&Match{16, 0, 4, 10},
-				&Match{8, 0, 10, 10},
+				testMatch(0, 0, 10, 10),
+				testMatch(16, 0, 4, 10),
+				testMatch(8, 0, 10, 10),
 			},
-			Consolidated: Matches{&Match{8, 0, 8, 10}},
+			Consolidated: Matches{testMatch(8, 0, 8, 10)},
 		},
 	}
 	for i, test := range tests {
@@ -66,3 +91,87 @@ func TestJoinOverlaps(t *testing.T) {
 		}
 	}
 }
+
+func TestGroupRectangles(t *testing.T) {
+	raw := Matches{
+		testMatch(10, 10, 20, 20),
+		testMatch(100, 100, 20, 20),
+		testMatch(11, 10, 20, 20),
+		testMatch(10, 11, 20, 20),
+		&Match{X: 50, Y: 0, Width: 10, Height: 10, Score: 2},
+		&Match{X: 52, Y: 0, Width: 10, Height: 10, Score: 5},
+		&Match{X: 54, Y: 0, Width: 10, Height: 10, Score: 1},
+	}
+	if res := raw.GroupRectangles(0, DefaultGroupEpsilon); !matchRectsEqual(res, raw) {
+		t.Error("matches should not be grouped without minNeighbors")
+	}
+
+	res := raw.GroupRectangles(1, DefaultGroupEpsilon)
+	expected := Matches{testMatch(10, 10, 20, 20), testMatch(52, 0, 10, 10)}
+	if !matchRectsEqual(res, expected) {
+		t.Fatalf("expected %v but got %v", expected, res)
+	}
+	if res[0].Count != 3 || res[1].Count != 3 || res[1].Score != 5 {
+		t.Errorf("unexpected groups: %+v %+v", res[0], res[1])
+	}
+
+	if res := raw.GroupRectangles(3, DefaultGroupEpsilon); len(res) != 0 {
+		t.Errorf("expected no groups but got %v", res)
+	}
+}
+
+func TestGroupRectanglesCounts(t *testing.T) {
+	// Groups are sized by their number of matches, not by
+	// the counts of those matches.
+	raw := Matches{
+		&Match{X: 10, Y: 11, Width: 20, Height: 20, Count: 5},
+		&Match{X: 100, Y: 100, Width: 20, Height: 20, Count: 5},
+		&Match{X: 11, Y: 12, Width: 21, Height: 20, Count: 5},
+	}
+	res := raw.GroupRectangles(1, DefaultGroupEpsilon)
+	// Halves are rounded to even, like cvRound.
+	expected := Matches{testMatch(10, 12, 20, 20)}
+	if !matchRectsEqual(res, expected) {
+		t.Fatalf("expected %v but got %v", expected, res)
+	}
+	if res[0].Count != 2 {
+		t.Errorf("expected count 2 but got %d", res[0].Count)
+	}
+}
+
+func TestGroupRectanglesNested(t *testing.T) {
+	var raw Matches
+	for i := 0; i < 5; i++ {
+		raw = append(raw, testMatch(i, 0, 100, 100))
+	}
+	raw = append(raw, testMatch(20, 20, 20, 20), testMatch(21, 20, 20, 20))
+	expected := Matches{testMatch(2, 0, 100, 100)}
+	if res := raw.GroupRectangles(1, DefaultGroupEpsilon); !matchRectsEqual(res, expected) {
+		t.Errorf("expected %v but got %v", expected, res)
+	}
+
+	// Big groups are not absorbed by smaller ones.
+	raw = append(raw, testMatch(20, 21, 20, 20), testMatch(21, 21, 20, 20),
+		testMatch(20, 20, 20, 20))
+	expected = Matches{testMatch(2, 0, 100, 100), testMatch(20, 20, 20, 20)}
+	if res := raw.GroupRectangles(1, DefaultGroupEpsilon); !matchRectsEqual(res, expected) {
+		t.Errorf("expected %v but got %v", expected, res)
+	}
+}
+
+func testMatch(x, y, width, height int) *Match {
+	return &Match{X: x, Y: y, Width: width, Height: height}
+}
+
+func matchRectsEqual(m1, m2 Matches) bool {
+	if len(m1) != len(m2) {
+		return false
+	}
+	for i, x := range m1 {
+		y := m2[i]
+		if x.X != y.X || x.Y != y.Y || x.Width != y.Width || x.Height != y.Height {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,267 @@
+package haar
+
+import (
+	"context"
+	"errors"
+)
+
+// A MirrorableFeature is a WindowFeature which can create
+// a version of itself for horizontally mirrored windows.
+//
+// Features which do not implement MirrorableFeature are
+// mirrored by evaluating them on mirrored copies of each
+// window.
+type MirrorableFeature interface {
+	WindowFeature
+
+	// MirroredFeature creates a feature whose value on a
+	// mirrored window is sign times this feature's value
+	// on the original window.
+	// The sign is either 1 or -1.
+	MirroredFeature(windowWidth int) (feature WindowFeature, sign float64)
+}
+
+// MirroredFeature creates the mirror image of the feature
+// for windows of the given width.
+//
+// Features which subtract their right side from their
+// left side, such as HorizontalPair, have a sign of -1.
+// Tilted features are mirrored by swapping their width
+// and height, so a TiltedHorizontalPair becomes a
+// TiltedVerticalPair and vice versa.
+//
+// A tilted feature never covers the leftmost column of a
+// window, since its left corner must be inside the
+// window.
+// Thus, the mirror image of a tilted feature which covers
+// the rightmost column is shifted right by one pixel, so
+// its value is only approximately the same.
+func (f *Feature) MirroredFeature(windowWidth int) (feature WindowFeature, sign float64) {
+	res := *f
+	sign = 1
+	switch f.Type {
+	case HorizontalPair, Diagonal, HorizontalGapPair:
+		sign = -1
+	case TiltedHorizontalPair:
+		res.Type = TiltedVerticalPair
+	case TiltedVerticalPair:
+		res.Type = TiltedHorizontalPair
+	case TiltedHorizontalTriple:
+		res.Type = TiltedVerticalTriple
+	case TiltedVerticalTriple:
+		res.Type = TiltedHorizontalTriple
+	}
+	if f.Type.Tilted() {
+		res.Width, res.Height = f.Height, f.Width
+		res.X = windowWidth - (f.X + 1)
+		if res.X < res.Height {
+			res.X = res.Height
+		}
+	} else {
+		res.X = windowWidth - (f.X + f.Width)
+	}
+	return &res, sign
+}
+
+// Mirrored creates a cascade which detects the mirror
+// image of whatever this cascade detects.
+//
+// Every feature is mirrored horizontally, and the
+// thresholds, weights, lookup tables, and decision trees
+// are adjusted to account for features whose sign flips.
+// The mirrored cascade gives the same layer sums on a
+// mirrored window as the original cascade gives on the
+// original window, except for rounding, for feature
+// values which exactly equal a threshold, and for tilted
+// features which touch the right edge of the window (see
+// Feature.MirroredFeature).
+//
+// If the cascade contains features which do not
+// implement MirrorableFeature, the mirrored cascade
+// cannot be encoded as JSON.
+func (c *Cascade) Mirrored() *Cascade {
+	res := &Cascade{
+		Layers:       make([]*Layer, len(c.Layers)),
+		WindowWidth:  c.WindowWidth,
+		WindowHeight: c.WindowHeight,
+	}
+	for i, layer := range c.Layers {
+		res.Layers[i] = layer.mirrored(c.WindowWidth)
+	}
+	return res
+}
+
+// ScanMirrored is like ScanWithOptions, but it scans for
+// both the cascade and its mirror image (see Mirrored) in
+// a single pass over the image.
+//
+// Each row of windows is scanned with the original
+// cascade and then with the mirrored one, and matches
+// from the mirrored cascade have Mirrored set.
+func (c *Cascade) ScanMirrored(ctx context.Context, img *DualImage,
+	opts *ScanOptions) (Matches, error) {
+	if opts == nil {
+		opts = &ScanOptions{}
+	}
+	mirror := c.Mirrored()
+	levels := classifierScanLevels(c, img, opts)
+	mirrorScaled := map[*scanLevel]scanClassifier{}
+	for _, level := range levels {
+		if level.scaled != nil {
+			mirrorScaled[level] = mirror.scaledClassifier(level.width, level.height)
+		}
+	}
+	return runScan(ctx, levels, opts, func(level *scanLevel, y int) Matches {
+		res := scanRow(c, img, level, y)
+
+		// The copy shares the level's pyramid image, which
+		// only exists while the level is being scanned.
+		mirrorLevel := *level
+		mirrorLevel.scaled = mirrorScaled[level]
+		for _, match := range scanRow(mirror, img, &mirrorLevel, y) {
+			match.Mirrored = true
+			res = append(res, match)
+		}
+		return res
+	})
+}
+
+// mirrored creates a version of the layer for mirrored
+// windows of the given width.
+func (c *Layer) mirrored(windowWidth int) *Layer {
+	res := &Layer{
+		Features:   make([]WindowFeature, len(c.Features)),
+		Thresholds: append([]float64{}, c.Thresholds...),
+		Weights:    append([]float64{}, c.Weights...),
+		Threshold:  c.Threshold,
+	}
+	for i, feature := range c.Features {
+		mirrored, sign := mirrorFeature(feature, windowWidth)
+		res.Features[i] = mirrored
+		if table := c.table(i); table != nil {
+			if res.Tables == nil {
+				res.Tables = make([]*LookupTable, len(c.Features))
+			}
+			if sign < 0 {
+				res.Tables[i] = table.negated()
+			} else {
+				res.Tables[i] = table.copy()
+			}
+		}
+		if tree := c.tree(i); tree != nil {
+			if res.Trees == nil {
+				res.Trees = make([]*DecisionTree, len(c.Features))
+			}
+			res.Trees[i] = tree.mirrored(windowWidth)
+		}
+		if sign < 0 {
+			res.Thresholds[i] = -c.Thresholds[i]
+			if c.table(i) == nil && c.tree(i) == nil {
+				// A stump outputs its weight when the value is
+				// greater than its threshold, so a negated value
+				// calls for a negated weight.
+				res.Weights[i] = -c.Weights[i]
+			}
+		}
+	}
+	return res
+}
+
+// mirrored creates a version of the tree for mirrored
+// windows of the given width.
+func (d *DecisionTree) mirrored(windowWidth int) *DecisionTree {
+	if d.Feature == nil {
+		return &DecisionTree{Output: d.Output}
+	}
+	feature, sign := mirrorFeature(d.Feature, windowWidth)
+	res := &DecisionTree{
+		Feature:   feature,
+		Threshold: d.Threshold,
+		Low:       d.Low.mirrored(windowWidth),
+		High:      d.High.mirrored(windowWidth),
+	}
+	if sign < 0 {
+		res.Threshold = -res.Threshold
+		res.Low, res.High = res.High, res.Low
+	}
+	return res
+}
+
+// negated creates a table for feature values which have
+// been negated.
+func (l *LookupTable) negated() *LookupTable {
+	res := &LookupTable{
+		Min:    -l.Max,
+		Max:    -l.Min,
+		Values: make([]float64, len(l.Values)),
+	}
+	for i, x := range l.Values {
+		res.Values[len(l.Values)-(i+1)] = x
+	}
+	return res
+}
+
+// mirrorFeature mirrors a feature like
+// Feature.MirroredFeature.
+func mirrorFeature(f WindowFeature, windowWidth int) (WindowFeature, float64) {
+	if mirrorable, ok := f.(MirrorableFeature); ok {
+		return mirrorable.MirroredFeature(windowWidth)
+	}
+	return &windowMirroredFeature{Feature: f}, 1
+}
+
+// A windowMirroredFeature evaluates a feature on mirrored
+// copies of windows.
+type windowMirroredFeature struct {
+	Feature WindowFeature
+}
+
+func (w *windowMirroredFeature) Value(img IntegralImage) float64 {
+	return w.Feature.Value(&mirroredImage{img: img})
+}
+
+func (w *windowMirroredFeature) Kind() string {
+	return w.Feature.Kind()
+}
+
+func (w *windowMirroredFeature) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("cannot encode mirrored feature of kind " + w.Kind())
+}
+
+// MirrorImage creates a horizontally mirrored copy of an
+// image.
+//
+// The result supports tilted features, since it is
+// stored like the result of BitmapIntegralImage.
+func MirrorImage(img IntegralImage) IntegralImage {
+	width, height := img.Width(), img.Height()
+	pixels := imagePixels(img)
+	for y := 0; y < height; y++ {
+		row := pixels[y*width : (y+1)*width]
+		for i := 0; i < width/2; i++ {
+			row[i], row[width-(i+1)] = row[width-(i+1)], row[i]
+		}
+	}
+	return BitmapIntegralImage(pixels, width, height)
+}
+
+// A mirroredImage is a horizontally mirrored view of an
+// image.
+// Unlike MirrorImage, it does not copy the image, but it
+// does not support tilted features.
+type mirroredImage struct {
+	img IntegralImage
+}
+
+func (m *mirroredImage) Width() int {
+	return m.img.Width()
+}
+
+func (m *mirroredImage) Height() int {
+	return m.img.Height()
+}
+
+func (m *mirroredImage) IntegralAt(x, y int) float64 {
+	width := m.img.Width()
+	return m.img.IntegralAt(width, y) - m.img.IntegralAt(width-x, y)
+}
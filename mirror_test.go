@@ -0,0 +1,122 @@
+package haar
+
+import (
+	"context"
+	"image"
+	"math"
+	"testing"
+)
+
+func TestFeatureMirrored(t *testing.T) {
+	img := featureTestImage()
+	mirrored := MirrorImage(img)
+	var features []WindowFeature
+	features = append(features, windowFeatures(everyFeature(imageTestBitmapWidth,
+		imageTestBitmapHeight))...)
+	features = append(features, AllLBPFeatures(imageTestBitmapWidth,
+		imageTestBitmapHeight)...)
+	for _, f := range features {
+		if h, ok := f.(*Feature); ok && h.Type.Tilted() && h.X+h.Width == imageTestBitmapWidth {
+			// These features are shifted when mirrored.
+			continue
+		}
+		mirror, sign := f.(MirrorableFeature).MirroredFeature(imageTestBitmapWidth)
+		expected := sign * f.Value(img)
+		if actual := mirror.Value(mirrored); math.Abs(actual-expected) > 1e-8 {
+			t.Errorf("feature %v: expected %f got %f", f, expected, actual)
+		}
+		again, sign2 := mirror.(MirrorableFeature).MirroredFeature(imageTestBitmapWidth)
+		if again.Value(img) != f.Value(img) || sign*sign2 != 1 {
+			t.Errorf("feature %v: mirroring twice gave %v", f, again)
+		}
+	}
+}
+
+func TestTiltedFeatureMirroredEdge(t *testing.T) {
+	f := &Feature{TiltedHorizontalPair, 3, 0, 4, 2}
+	mirror, _ := f.MirroredFeature(7)
+	expected := Feature{TiltedVerticalPair, 4, 0, 2, 4}
+	if *mirror.(*Feature) != expected {
+		t.Errorf("expected %v got %v", expected, mirror)
+	}
+}
+
+func TestCascadeMirrored(t *testing.T) {
+	img := NewDualImage(scanTestImage(30, 20, 6))
+	for i, cascade := range []*Cascade{scanTestCascade(), boostTestCascade(),
+		treeTestCascade(), templateTestCascade()} {
+		mirror := cascade.Mirrored()
+		for y := 0; y+8 <= img.Height(); y++ {
+			for x := 0; x+8 <= img.Width(); x++ {
+				window := img.Window(x, y, 8, 8)
+				expected, _ := cascade.Sums(window)
+				actual, _ := mirror.Sums(MirrorImage(window))
+				if len(actual) != len(expected) {
+					t.Fatalf("cascade %d window %d,%d: expected sums %v got %v", i, x, y,
+						expected, actual)
+				}
+				for j, sum := range expected {
+					if math.Abs(actual[j]-sum) > 1e-8 {
+						t.Fatalf("cascade %d window %d,%d: expected sums %v got %v", i, x,
+							y, expected, actual)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestScanMirrored(t *testing.T) {
+	cascade := boostTestCascade()
+	original := scanTestImage(40, 30, 2)
+	mirrored := NewDualImage(MirrorImage(original))
+	opts := &ScanOptions{MaxSize: image.Pt(8, 8)}
+
+	expected := cascade.Scan(NewDualImage(original), 0, 0)
+	actual, err := cascade.ScanMirrored(context.Background(), mirrored, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mirrorMatches int
+	for _, match := range actual {
+		if !match.Mirrored {
+			continue
+		}
+		mirrorMatches++
+		var found bool
+		for _, x := range expected {
+			if x.X == mirrored.Width()-(match.X+match.Width) && x.Y == match.Y &&
+				x.Width == match.Width && math.Abs(x.Score-match.Score) < 1e-8 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("unexpected mirrored match: %v", match)
+		}
+	}
+	var expectedCount int
+	for _, x := range expected {
+		if x.Width == 8 {
+			expectedCount++
+		}
+	}
+	if expectedCount == 0 || mirrorMatches != expectedCount {
+		t.Errorf("expected %d mirrored matches got %d", expectedCount, mirrorMatches)
+	}
+}
+
+func TestMirrorPositives(t *testing.T) {
+	source := MirrorPositives(poolTestSource())
+	positives := source.Positives()
+	if len(positives) != 80 {
+		t.Fatalf("expected 80 positives got %d", len(positives))
+	}
+	f := &Feature{HorizontalPair, 0, 0, 6, 6}
+	for i, x := range positives[:40] {
+		if math.Abs(f.Value(x)+f.Value(positives[i+40])) > 1e-8 {
+			t.Errorf("sample %d was not mirrored", i)
+		}
+	}
+}
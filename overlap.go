@@ -0,0 +1,139 @@
+package haar
+
+import (
+	"math"
+	"sort"
+)
+
+// An OverlapMetric specifies how to measure the overlap
+// between two matches.
+type OverlapMetric int
+
+const (
+	// SmallerAreaOverlap is the area of the intersection
+	// divided by the area of the smaller match, as
+	// computed by Match.Overlap.
+	// A small match inside a large one has an overlap of 1.
+	SmallerAreaOverlap OverlapMetric = iota
+
+	// IoUOverlap is the intersection over union, as
+	// computed by Match.IoU.
+	IoUOverlap
+)
+
+// Overlap measures the overlap between two matches.
+func (o OverlapMetric) Overlap(m1, m2 *Match) float64 {
+	switch o {
+	case SmallerAreaOverlap:
+		return m1.Overlap(m2)
+	case IoUOverlap:
+		return m1.IoU(m2)
+	default:
+		panic("unknown overlap metric")
+	}
+}
+
+// JoinOverlapsMetric is like JoinOverlaps, but with a
+// configurable overlap metric.
+func (m Matches) JoinOverlapsMetric(threshold float64, metric OverlapMetric) Matches {
+	clusters := clusterOverlaps(m, threshold, metric)
+	res := make(Matches, len(clusters))
+	for i, cluster := range clusters {
+		res[i] = cluster.average()
+	}
+	return res
+}
+
+// WeightedJoinOverlaps is like JoinOverlapsMetric, but
+// each joined match is the average of its matches
+// weighted by their scores, rounded to the nearest
+// integer.
+//
+// Negative scores are treated as 0.
+// If every match in a group has a score of 0, the matches
+// are weighted equally.
+// The other fields of the joined matches are computed
+// like in JoinOverlaps.
+func (m Matches) WeightedJoinOverlaps(threshold float64, metric OverlapMetric) Matches {
+	clusters := clusterOverlaps(m, threshold, metric)
+	res := make(Matches, len(clusters))
+	for i, cluster := range clusters {
+		res[i] = cluster.weightedAverage()
+	}
+	return res
+}
+
+// NonMaxSuppression performs greedy non-maximum
+// suppression.
+//
+// Matches are visited from the highest score to the
+// lowest, and a match is kept unless its overlap with a
+// match that was already kept exceeds threshold.
+// The result is sorted by descending score, and matches
+// with equal scores stay in their original order.
+//
+// The kept matches are copies whose Count includes the
+// matches they suppressed.
+// A suppressed match is attributed to the highest scoring
+// kept match that suppressed it.
+func (m Matches) NonMaxSuppression(threshold float64, metric OverlapMetric) Matches {
+	sorted := append(Matches{}, m...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Score > sorted[j].Score
+	})
+
+	var res Matches
+MatchLoop:
+	for _, match := range sorted {
+		for _, kept := range res {
+			if metric.Overlap(kept, match) > threshold {
+				kept.Count += match.count()
+				continue MatchLoop
+			}
+		}
+		kept := *match
+		kept.Count = match.count()
+		res = append(res, &kept)
+	}
+	return res
+}
+
+// count returns the number of raw matches that make up
+// the match.
+func (m *Match) count() int {
+	if m.Count > 0 {
+		return m.Count
+	}
+	return 1
+}
+
+func (m Matches) weightedAverage() *Match {
+	res := m.average()
+
+	weights := make([]float64, len(m))
+	var totalWeight float64
+	for i, match := range m {
+		weights[i] = math.Max(0, match.Score)
+		totalWeight += weights[i]
+	}
+	if totalWeight == 0 {
+		for i := range weights {
+			weights[i] = 1
+		}
+		totalWeight = float64(len(m))
+	}
+
+	var x, y, width, height float64
+	for i, match := range m {
+		w := weights[i] / totalWeight
+		x += w * float64(match.X)
+		y += w * float64(match.Y)
+		width += w * float64(match.Width)
+		height += w * float64(match.Height)
+	}
+	res.X = roundInt(x)
+	res.Y = roundInt(y)
+	res.Width = roundInt(width)
+	res.Height = roundInt(height)
+	return res
+}
@@ -0,0 +1,95 @@
+package haar
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMatchIoU(t *testing.T) {
+	tests := []struct {
+		M1  *Match
+		M2  *Match
+		IoU float64
+	}{
+		{testMatch(0, 0, 10, 10), testMatch(5, 0, 10, 10), 1.0 / 3},
+		{testMatch(0, 0, 10, 10), testMatch(0, 0, 20, 20), 0.25},
+		{testMatch(0, 0, 10, 10), testMatch(10, 0, 10, 10), 0},
+		{testMatch(0, 0, 10, 10), testMatch(0, 0, 10, 10), 1},
+		{
+			testMatch(0, 0, 10, 10),
+			&Match{Width: 10, Height: 10, Angle: math.Pi / 4},
+			2 * (math.Sqrt2 - 1) / (2 - 2*(math.Sqrt2-1)),
+		},
+	}
+	for i, test := range tests {
+		for _, actual := range []float64{test.M1.IoU(test.M2), test.M2.IoU(test.M1),
+			IoUOverlap.Overlap(test.M1, test.M2)} {
+			if math.Abs(actual-test.IoU) > 1e-8 {
+				t.Errorf("test %d: expected %f got %f", i, test.IoU, actual)
+			}
+		}
+	}
+}
+
+func TestJoinOverlapsMetric(t *testing.T) {
+	raw := Matches{testMatch(0, 0, 20, 20), testMatch(5, 5, 10, 10)}
+	if res := raw.JoinOverlapsMetric(0.5, SmallerAreaOverlap); len(res) != 1 {
+		t.Errorf("expected one match but got %d", len(res))
+	}
+	if res := raw.JoinOverlapsMetric(0.5, IoUOverlap); !matchRectsEqual(res, raw) {
+		t.Errorf("expected %v but got %v", raw, res)
+	}
+}
+
+func TestNonMaxSuppression(t *testing.T) {
+	raw := Matches{
+		&Match{X: 0, Y: 0, Width: 10, Height: 10, Score: 1},
+		&Match{X: 1, Y: 0, Width: 10, Height: 10, Score: 3},
+		&Match{X: 30, Y: 0, Width: 10, Height: 10, Score: 2},
+		&Match{X: 3, Y: 3, Width: 4, Height: 4, Score: 0.5},
+	}
+
+	res := raw.NonMaxSuppression(0.5, IoUOverlap)
+	expected := Matches{raw[1], raw[2], raw[3]}
+	if !matchRectsEqual(res, expected) {
+		t.Fatalf("expected %v but got %v", expected, res)
+	}
+	for i, count := range []int{2, 1, 1} {
+		if res[i].Count != count {
+			t.Errorf("match %d: expected count %d got %d", i, count, res[i].Count)
+		}
+	}
+	if res[0] == raw[1] || raw[1].Count != 0 {
+		t.Error("input matches should not be modified")
+	}
+
+	res = raw.NonMaxSuppression(0.5, SmallerAreaOverlap)
+	expected = Matches{raw[1], raw[2]}
+	if !matchRectsEqual(res, expected) {
+		t.Fatalf("expected %v but got %v", expected, res)
+	}
+	if res[0].Count != 3 || res[0].Score != 3 {
+		t.Errorf("unexpected match: %+v", res[0])
+	}
+}
+
+func TestWeightedJoinOverlaps(t *testing.T) {
+	raw := Matches{
+		&Match{X: 0, Y: 0, Width: 10, Height: 10, Score: 1},
+		&Match{X: 8, Y: 4, Width: 10, Height: 14, Score: 3},
+		&Match{X: 30, Y: 0, Width: 10, Height: 10},
+		&Match{X: 32, Y: 0, Width: 10, Height: 10},
+	}
+	res := raw.WeightedJoinOverlaps(0, SmallerAreaOverlap)
+	expected := Matches{testMatch(6, 3, 10, 13), testMatch(31, 0, 10, 10)}
+	if !matchRectsEqual(res, expected) {
+		t.Fatalf("expected %v but got %v", expected, res)
+	}
+	if res[0].Score != 3 || res[0].Count != 2 {
+		t.Errorf("unexpected match: %+v", res[0])
+	}
+
+	if res := raw.WeightedJoinOverlaps(0.5, IoUOverlap); len(res) != 3 {
+		t.Errorf("expected 3 matches but got %d", len(res))
+	}
+}
@@ -0,0 +1,186 @@
+package haar
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// A FeaturePool configures which features are considered
+// while training a layer.
+//
+// The zero value includes every Haar-like feature of a
+// basic type, like AllFeatures.
+type FeaturePool struct {
+	// Types lists the feature types to include.
+	// If it is empty, the basic types are included.
+	// Other types, such as the tilted ones, must be
+	// listed explicitly.
+	Types []FeatureType
+
+	// LBP specifies that the pool should consist of
+	// LBPFeatures rather than Haar-like features.
+	// If LBP is set, Types is ignored.
+	LBP bool
+
+	// MinWidth and MinHeight are the minimum size of a
+	// feature.
+	// For LBP features, this is the size of the grid.
+	MinWidth  int
+	MinHeight int
+
+	// PositionStep is the step between the coordinates of
+	// features.
+	// Only features whose X and Y are multiples of
+	// PositionStep are included.
+	// If it is 0, every position is included.
+	PositionStep int
+
+	// SizeStep is the step between the sizes of the parts
+	// of features, starting at one pixel.
+	// For example, if SizeStep is 2, the parts of a
+	// feature may be 1, 3, 5, etc. pixels wide.
+	// For LBP features, the parts are the cells.
+	// If it is 0, every size is included.
+	SizeStep int
+
+	// MaxCount is the maximum number of features.
+	// If more features match the other settings, a random
+	// subset of them is chosen.
+	// If it is 0, there is no limit.
+	MaxCount int
+
+	// Seed seeds the random subset, so that a pool always
+	// yields the same features for a given window size.
+	Seed int64
+}
+
+// Features generates the features in the pool for the
+// given window size.
+//
+// The features are returned in the same order as by
+// AllFeatures or AllLBPFeatures.
+func (p *FeaturePool) Features(width, height int) []WindowFeature {
+	sampler := &featureSampler{max: p.MaxCount}
+	if p.MaxCount > 0 {
+		sampler.gen = rand.New(rand.NewSource(p.Seed))
+	}
+	if p.LBP {
+		for _, feature := range AllLBPFeatures(width, height) {
+			f := feature.(*LBPFeature)
+			if p.includes(f.X, f.Y, f.CellWidth*3, f.CellHeight*3, f.CellWidth, f.CellHeight) {
+				sampler.Add(f)
+			}
+		}
+	} else {
+		forEachFeature(width, height, func(f Feature) {
+			if !p.includesType(f.Type) {
+				return
+			}
+			xParts, yParts := f.parts()
+			if p.includes(f.X, f.Y, f.Width, f.Height, f.Width/xParts, f.Height/yParts) {
+				sampler.Add(&f)
+			}
+		})
+	}
+	return sampler.Features()
+}
+
+// Validate returns an error if the pool has no features
+// for the given window size.
+// Pools taken from users should be validated before they
+// are used for training.
+func (p *FeaturePool) Validate(width, height int) error {
+	if len(p.Features(width, height)) == 0 {
+		return fmt.Errorf("no features fit the pool settings for a %dx%d window",
+			width, height)
+	}
+	return nil
+}
+
+func (p *FeaturePool) includesType(t FeatureType) bool {
+	if len(p.Types) == 0 {
+		return t.Basic()
+	}
+	for _, x := range p.Types {
+		if x == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *FeaturePool) includes(x, y, width, height, partWidth, partHeight int) bool {
+	if width < p.MinWidth || height < p.MinHeight {
+		return false
+	}
+	if p.PositionStep > 1 && (x%p.PositionStep != 0 || y%p.PositionStep != 0) {
+		return false
+	}
+	if p.SizeStep > 1 && ((partWidth-1)%p.SizeStep != 0 || (partHeight-1)%p.SizeStep != 0) {
+		return false
+	}
+	return true
+}
+
+// ParseFeatureTypes parses a comma-separated list of
+// feature type names.
+// An empty string yields an empty list.
+func ParseFeatureTypes(list string) ([]FeatureType, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var res []FeatureType
+	for _, name := range strings.Split(list, ",") {
+		t, err := ParseFeatureType(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+// A featureSampler chooses a uniformly random subset of a
+// stream of features using reservoir sampling.
+// If max is 0, every feature is kept.
+type featureSampler struct {
+	max int
+	gen *rand.Rand
+
+	count    int
+	features []WindowFeature
+	indices  []int
+}
+
+func (f *featureSampler) Add(feature WindowFeature) {
+	if f.max == 0 || len(f.features) < f.max {
+		f.features = append(f.features, feature)
+		f.indices = append(f.indices, f.count)
+	} else if j := f.gen.Intn(f.count + 1); j < f.max {
+		f.features[j] = feature
+		f.indices[j] = f.count
+	}
+	f.count++
+}
+
+// Features returns the chosen features in the order they
+// were added.
+func (f *featureSampler) Features() []WindowFeature {
+	sort.Sort(f)
+	return f.features
+}
+
+func (f *featureSampler) Len() int {
+	return len(f.features)
+}
+
+func (f *featureSampler) Less(i, j int) bool {
+	return f.indices[i] < f.indices[j]
+}
+
+func (f *featureSampler) Swap(i, j int) {
+	f.features[i], f.features[j] = f.features[j], f.features[i]
+	f.indices[i], f.indices[j] = f.indices[j], f.indices[i]
+}
@@ -0,0 +1,223 @@
+package haar
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestFeaturePoolDefault(t *testing.T) {
+	all := AllFeatures(7, 6)
+	pool := (&FeaturePool{}).Features(7, 6)
+	if len(pool) != len(all) {
+		t.Fatalf("expected %d features got %d", len(all), len(pool))
+	}
+	for i, f := range pool {
+		if *f.(*Feature) != *all[i] {
+			t.Fatalf("feature %d: expected %v got %v", i, *all[i], f)
+		}
+	}
+}
+
+func TestFeaturePoolFilters(t *testing.T) {
+	pool := &FeaturePool{
+		Types:        []FeatureType{HorizontalPair, TiltedVerticalTriple},
+		MinWidth:     2,
+		MinHeight:    3,
+		PositionStep: 2,
+		SizeStep:     2,
+	}
+	features := pool.Features(12, 12)
+	if len(features) == 0 {
+		t.Fatal("expected some features")
+	}
+	seenTypes := map[FeatureType]bool{}
+	for _, feature := range features {
+		f := feature.(*Feature)
+		seenTypes[f.Type] = true
+		if f.Type != HorizontalPair && f.Type != TiltedVerticalTriple {
+			t.Errorf("unexpected type: %v", f)
+		}
+		if f.Width < 2 || f.Height < 3 {
+			t.Errorf("feature too small: %v", f)
+		}
+		if f.X%2 != 0 || f.Y%2 != 0 {
+			t.Errorf("unexpected position: %v", f)
+		}
+		xParts, yParts := f.parts()
+		if (f.Width/xParts)%2 != 1 || (f.Height/yParts)%2 != 1 {
+			t.Errorf("unexpected size: %v", f)
+		}
+	}
+	if len(seenTypes) != 2 {
+		t.Errorf("expected both types but got %v", seenTypes)
+	}
+}
+
+func TestFeaturePoolMaxCount(t *testing.T) {
+	all := AllFeatures(8, 8)
+	pool := &FeaturePool{MaxCount: 100, Seed: 3}
+	features := pool.Features(8, 8)
+	if len(features) != pool.MaxCount {
+		t.Fatalf("expected %d features got %d", pool.MaxCount, len(features))
+	}
+
+	var allIdx int
+	for i, f := range features {
+		for allIdx < len(all) && *all[allIdx] != *f.(*Feature) {
+			allIdx++
+		}
+		if allIdx == len(all) {
+			t.Fatalf("feature %d is out of order or missing from AllFeatures", i)
+		}
+	}
+
+	again := pool.Features(8, 8)
+	for i, f := range features {
+		if *f.(*Feature) != *again[i].(*Feature) {
+			t.Fatal("features differ for the same seed")
+		}
+	}
+
+	other := (&FeaturePool{MaxCount: 100, Seed: 4}).Features(8, 8)
+	var same int
+	for i, f := range features {
+		if *f.(*Feature) == *other[i].(*Feature) {
+			same++
+		}
+	}
+	if same == len(features) {
+		t.Error("features should differ for different seeds")
+	}
+}
+
+func TestFeaturePoolLBP(t *testing.T) {
+	pool := &FeaturePool{LBP: true, MinWidth: 6, PositionStep: 2}
+	features := pool.Features(9, 9)
+	if len(features) == 0 {
+		t.Fatal("expected some features")
+	}
+	for _, feature := range features {
+		f, ok := feature.(*LBPFeature)
+		if !ok {
+			t.Fatalf("unexpected feature: %v", feature)
+		}
+		if f.CellWidth < 2 || f.X%2 != 0 || f.Y%2 != 0 {
+			t.Errorf("unexpected feature: %v", *f)
+		}
+	}
+}
+
+func TestFeaturePoolValidate(t *testing.T) {
+	if err := (&FeaturePool{MinWidth: 4}).Validate(9, 9); err != nil {
+		t.Error(err)
+	}
+	if err := (&FeaturePool{MinWidth: 10}).Validate(9, 9); err == nil {
+		t.Error("expected error for empty pool")
+	}
+	if err := (&FeaturePool{LBP: true}).Validate(2, 2); err == nil {
+		t.Error("expected error for window smaller than an LBP grid")
+	}
+}
+
+func TestParseFeatureTypes(t *testing.T) {
+	types, err := ParseFeatureTypes("diagonal, tilted-horizontal-pair,vertical-gap-pair")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []FeatureType{Diagonal, TiltedHorizontalPair, VerticalGapPair}
+	if len(types) != len(expected) {
+		t.Fatalf("expected %v got %v", expected, types)
+	}
+	for i, x := range expected {
+		if types[i] != x {
+			t.Errorf("type %d: expected %v got %v", i, x, types[i])
+		}
+	}
+	for t1 := HorizontalPair; t1 <= VerticalGapPair; t1++ {
+		if t2, err := ParseFeatureType(t1.String()); err != nil || t2 != t1 {
+			t.Errorf("type %d did not round trip", t1)
+		}
+	}
+	if _, err := ParseFeatureTypes("diagonal,triangle"); err == nil {
+		t.Error("expected error for unknown type")
+	}
+}
+
+func TestTrainMorePool(t *testing.T) {
+	source := poolTestSource()
+	reqs := []*Requirements{
+		{
+			PositiveRetention: 0.95,
+			NegativeExclusion: 0.5,
+			MaxFeatures:       3,
+			Boosting:          GentleAdaBoost,
+			Pool:              &FeaturePool{Types: []FeatureType{VerticalPair}},
+		},
+		{
+			PositiveRetention: 0.95,
+			NegativeExclusion: 0.5,
+			MaxFeatures:       3,
+			Boosting:          GentleAdaBoost,
+			Pool:              &FeaturePool{LBP: true},
+		},
+	}
+	cascade := Train(reqs, source, nil)
+	if len(cascade.Layers) != 2 {
+		t.Fatalf("expected 2 layers got %d", len(cascade.Layers))
+	}
+	for _, f := range cascade.Layers[0].Features {
+		if haarFeature, ok := f.(*Feature); !ok || haarFeature.Type != VerticalPair {
+			t.Errorf("unexpected feature in first layer: %v", f)
+		}
+	}
+	for _, f := range cascade.Layers[1].Features {
+		if _, ok := f.(*LBPFeature); !ok {
+			t.Errorf("unexpected feature in second layer: %v", f)
+		}
+	}
+}
+
+func TestTrainEmptyPool(t *testing.T) {
+	reqs := []*Requirements{{
+		PositiveRetention: 0.95,
+		NegativeExclusion: 0.5,
+		MaxFeatures:       3,
+		Pool:              &FeaturePool{MinWidth: 1000},
+	}}
+	if cascade := Train(reqs, poolTestSource(), nil); len(cascade.Layers) != 0 {
+		t.Errorf("expected no layers got %d", len(cascade.Layers))
+	}
+}
+
+type poolTestSamples struct {
+	pos []IntegralImage
+	neg []IntegralImage
+}
+
+func poolTestSource() *poolTestSamples {
+	gen := rand.New(rand.NewSource(1337))
+	res := &poolTestSamples{}
+	for i := 0; i < 40; i++ {
+		res.pos = append(res.pos, boostTestSample(gen, true))
+		res.neg = append(res.neg, boostTestSample(gen, false))
+	}
+	return res
+}
+
+func (p *poolTestSamples) Positives() []IntegralImage {
+	return p.pos
+}
+
+func (p *poolTestSamples) InitialNegatives() []IntegralImage {
+	return p.neg
+}
+
+func (p *poolTestSamples) AdversarialNegatives(c *Cascade) []IntegralImage {
+	var res []IntegralImage
+	for _, x := range p.neg {
+		if c.Classify(x) {
+			res = append(res, x)
+		}
+	}
+	return res
+}
@@ -0,0 +1,188 @@
+package haar
+
+import (
+	"context"
+	"math"
+)
+
+// Rotate creates a copy of the image rotated by the given
+// angle, in radians, about its center.
+//
+// Positive angles rotate the image counterclockwise as it
+// is displayed (with y pointing down), so that an object
+// which was tilted clockwise by the angle becomes upright.
+// The new image is just large enough to contain the
+// entire rotated image, and the area outside of the
+// original image is black.
+// Pixels are sampled with bilinear interpolation.
+func (d *DualImage) Rotate(angle float64) *DualImage {
+	return d.rotate(angle, d.format)
+}
+
+// rotate is like Rotate, but the new image uses the given
+// format.
+func (d *DualImage) rotate(angle float64, format IntegralFormat) *DualImage {
+	r := newImageRotation(d.Width(), d.Height(), angle)
+	pixels := imagePixels(d.image)
+	pixel := func(x, y int) float64 {
+		if x < 0 || y < 0 || x >= d.Width() || y >= d.Height() {
+			return 0
+		}
+		return pixels[x+y*d.Width()]
+	}
+
+	bitmap := make([]float64, r.width*r.height)
+	var idx int
+	for y := 0; y < r.height; y++ {
+		for x := 0; x < r.width; x++ {
+			srcX, srcY := r.original(float64(x)+0.5, float64(y)+0.5)
+			srcX -= 0.5
+			srcY -= 0.5
+			x0, y0 := math.Floor(srcX), math.Floor(srcY)
+			fx, fy := srcX-x0, srcY-y0
+			ix, iy := int(x0), int(y0)
+			top := pixel(ix, iy)*(1-fx) + pixel(ix+1, iy)*fx
+			bottom := pixel(ix, iy+1)*(1-fx) + pixel(ix+1, iy+1)*fx
+			bitmap[idx] = top*(1-fy) + bottom*fy
+			idx++
+		}
+	}
+
+	return dualImageFromBitmap(bitmap, r.width, r.height, format)
+}
+
+// ScanRotated scans for objects at every given angle of
+// in-plane rotation, in radians.
+//
+// For each angle, the image is rotated like Rotate, in
+// the options' Format, and scanned with ScanWithOptions.
+// The matches are mapped back into the original image.
+// Each resulting match is the rectangle given by X, Y,
+// Width, and Height rotated clockwise about its center by
+// Match.Angle.
+// Matches which extend past the edges of the original
+// image are discarded.
+//
+// The options' Region, if set, is in the coordinates of
+// the rotated images.
+//
+// Overlapping matches from different angles can be
+// merged with Matches.JoinOverlaps, which takes angles
+// into account.
+func (c *Cascade) ScanRotated(ctx context.Context, img *DualImage, angles []float64,
+	opts *ScanOptions) (Matches, error) {
+	return scanRotated(ctx, img, angles, opts, func(img *DualImage) (Matches, error) {
+		return c.ScanWithOptions(ctx, img, opts)
+	})
+}
+
+// ScanRotated is like Cascade.ScanRotated, but for a
+// compiled cascade.
+func (c *CompiledCascade) ScanRotated(ctx context.Context, img *DualImage,
+	angles []float64, opts *ScanOptions) (Matches, error) {
+	return scanRotated(ctx, img, angles, opts, func(img *DualImage) (Matches, error) {
+		return c.ScanWithOptions(ctx, img, opts)
+	})
+}
+
+// ScanRotated is like Cascade.ScanRotated, but for a
+// soft cascade.
+func (s *SoftCascade) ScanRotated(ctx context.Context, img *DualImage, angles []float64,
+	opts *ScanOptions) (Matches, error) {
+	return scanRotated(ctx, img, angles, opts, func(img *DualImage) (Matches, error) {
+		return s.ScanWithOptions(ctx, img, opts)
+	})
+}
+
+func scanRotated(ctx context.Context, img *DualImage, angles []float64,
+	opts *ScanOptions, scan func(img *DualImage) (Matches, error)) (Matches, error) {
+	var format IntegralFormat
+	if opts != nil {
+		format = opts.Format
+	}
+	var res Matches
+	for _, angle := range angles {
+		if angle == 0 {
+			matches, err := scan(img)
+			res = append(res, matches...)
+			if err != nil {
+				return res, err
+			}
+			continue
+		}
+
+		matches, err := scan(img.rotate(angle, format))
+		for _, match := range matches {
+			mapped := match.FromRotated(angle, img.Width(), img.Height())
+			if mapped.fits(img.Width(), img.Height()) {
+				res = append(res, mapped)
+			}
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// An imageRotation maps between the coordinates of an
+// image and a rotated copy of it.
+type imageRotation struct {
+	cos float64
+	sin float64
+
+	origWidth  int
+	origHeight int
+
+	width  int
+	height int
+}
+
+// newImageRotation creates a rotation for an image of
+// the given size.
+// The rotated size is rounded up, ignoring tiny errors
+// so that right angles give exact sizes.
+func newImageRotation(width, height int, angle float64) *imageRotation {
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	w, h := float64(width), float64(height)
+	return &imageRotation{
+		cos:        cos,
+		sin:        sin,
+		origWidth:  width,
+		origHeight: height,
+		width:      int(math.Ceil(math.Abs(w*cos) + math.Abs(h*sin) - 1e-8)),
+		height:     int(math.Ceil(math.Abs(w*sin) + math.Abs(h*cos) - 1e-8)),
+	}
+}
+
+// original maps a point in the rotated image to a point
+// in the original image.
+func (r *imageRotation) original(x, y float64) (float64, float64) {
+	x -= float64(r.width) / 2
+	y -= float64(r.height) / 2
+	return r.cos*x - r.sin*y + float64(r.origWidth)/2,
+		r.sin*x + r.cos*y + float64(r.origHeight)/2
+}
+
+// rotated maps a point in the original image to a point
+// in the rotated image.
+func (r *imageRotation) rotated(x, y float64) (float64, float64) {
+	x -= float64(r.origWidth) / 2
+	y -= float64(r.origHeight) / 2
+	return r.cos*x + r.sin*y + float64(r.width)/2,
+		-r.sin*x + r.cos*y + float64(r.height)/2
+}
+
+// fits checks if a match is inside an image of the given
+// size.
+func (m *Match) fits(width, height int) bool {
+	// Rounding can move corners by up to a pixel.
+	const slack = 1
+	for _, corner := range m.Corners() {
+		if corner[0] < -slack || corner[1] < -slack ||
+			corner[0] > float64(width)+slack || corner[1] > float64(height)+slack {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package haar
+
+import (
+	"context"
+	"image"
+	"math"
+	"testing"
+)
+
+func TestDualImageRotate(t *testing.T) {
+	img := NewDualImage(scanTestImage(13, 7, 1))
+
+	pixels := imagePixels(img.image)
+	rotated := img.Rotate(math.Pi / 2)
+	rotatedPixels := imagePixels(rotated.image)
+	if rotated.Width() != 7 || rotated.Height() != 13 {
+		t.Fatalf("unexpected size %dx%d", rotated.Width(), rotated.Height())
+	}
+	for y := 0; y < rotated.Height(); y++ {
+		for x := 0; x < rotated.Width(); x++ {
+			expected := pixels[13-(y+1)+x*13]
+			if actual := rotatedPixels[x+y*7]; math.Abs(actual-expected) > 1e-5 {
+				t.Fatalf("pixel %d,%d: expected %f got %f", x, y, expected, actual)
+			}
+		}
+	}
+
+	diagonal := img.Rotate(math.Pi / 4)
+	size := int(math.Ceil(20 / math.Sqrt2))
+	if diagonal.Width() != size || diagonal.Height() != size {
+		t.Errorf("unexpected size %dx%d", diagonal.Width(), diagonal.Height())
+	}
+	if corner := imagePixels(diagonal.image)[0]; corner != 0 {
+		t.Errorf("corner should be black but got %f", corner)
+	}
+}
+
+func TestScanRotated(t *testing.T) {
+	cascade := boostTestCascade()
+	original := NewDualImage(scanTestImage(40, 30, 2))
+	opts := &ScanOptions{MaxSize: image.Pt(8, 8)}
+
+	expected, _ := cascade.ScanWithOptions(context.Background(), original, opts)
+	if len(expected) == 0 {
+		t.Fatal("no matches")
+	}
+
+	actual, err := cascade.ScanRotated(context.Background(), original, []float64{0}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !scanTestMatchesEqual(actual, expected) {
+		t.Error("unexpected matches for angle 0")
+	}
+
+	// Rotating the image counterclockwise means that
+	// objects must be found at a clockwise angle.
+	rotated := original.Rotate(math.Pi / 2)
+	actual, err = cascade.ScanRotated(context.Background(), rotated, []float64{-math.Pi / 2},
+		opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d matches got %d", len(expected), len(actual))
+	}
+	for i, match := range actual {
+		x := expected[i]
+		upright := &Match{X: x.Y, Y: original.Width() - (x.X + x.Width), Width: x.Height,
+			Height: x.Width}
+		if match.Angle != -math.Pi/2 || math.Abs(match.Score-x.Score) > 1e-5 ||
+			math.Abs(match.Overlap(upright)-1) > 1e-5 {
+			t.Errorf("match %d: expected %v but got %v (angle %f)", i, upright, match,
+				match.Angle)
+		}
+	}
+}
+
+func TestMatchOverlapRotated(t *testing.T) {
+	m1 := &Match{X: 10, Y: 10, Width: 10, Height: 10}
+	m2 := &Match{X: 10, Y: 10, Width: 10, Height: 10, Angle: math.Pi / 4}
+	expected := 2 * (math.Sqrt2 - 1)
+	if actual := m1.Overlap(m2); math.Abs(actual-expected) > 1e-8 {
+		t.Errorf("expected overlap %f got %f", expected, actual)
+	}
+	if actual := m2.Overlap(m1); math.Abs(actual-expected) > 1e-8 {
+		t.Errorf("expected overlap %f got %f", expected, actual)
+	}
+
+	m3 := &Match{X: 25, Y: 10, Width: 10, Height: 10, Angle: 0.1}
+	if actual := m2.Overlap(m3); actual != 0 {
+		t.Errorf("expected no overlap but got %f", actual)
+	}
+
+	joined := Matches{m1, m2, m3}.JoinOverlaps(0.5)
+	if len(joined) != 2 {
+		t.Fatalf("expected 2 matches got %d", len(joined))
+	}
+	if math.Abs(joined[0].Angle-math.Pi/8) > 1e-8 {
+		t.Errorf("expected average angle %f got %f", math.Pi/8, joined[0].Angle)
+	}
+}
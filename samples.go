@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	_ "image/jpeg"
 	_ "image/png"
@@ -56,7 +57,7 @@ func LoadSampleSource(positiveDir, negativeDir string) (SampleSource, error) {
 			continue
 		}
 		path := filepath.Join(positiveDir, item.Name())
-		img, err := readImage(path)
+		img, err := ReadDualImage(path)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read %s: %s", path, err)
 		}
@@ -83,7 +84,7 @@ func LoadSampleSource(positiveDir, negativeDir string) (SampleSource, error) {
 			continue
 		}
 		path := filepath.Join(negativeDir, item.Name())
-		img, err := readImage(path)
+		img, err := ReadDualImage(path)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read %s: %s", path, err)
 		}
@@ -94,17 +95,72 @@ func LoadSampleSource(positiveDir, negativeDir string) (SampleSource, error) {
 		neg = append(neg, img)
 	}
 
-	if len(neg) == 0 {
+	return NewSampleSource(pos, neg)
+}
+
+// NewSampleSource creates a SampleSource from positive
+// samples and images from which to crop negatives.
+//
+// The positive samples must all be the same dimensions,
+// and the negative images must be at least as big as the
+// positives.
+func NewSampleSource(positives []IntegralImage, negatives []*DualImage) (SampleSource, error) {
+	if len(positives) == 0 {
+		return nil, errors.New("no positive samples")
+	}
+	if len(negatives) == 0 {
 		return nil, errors.New("no negative samples")
 	}
-
+	width, height := positives[0].Width(), positives[0].Height()
+	for i, pos := range positives {
+		if pos.Width() != width || pos.Height() != height {
+			return nil, fmt.Errorf("positive %d: expected dimensions %dx%d got %dx%d", i,
+				width, height, pos.Width(), pos.Height())
+		}
+	}
+	for i, neg := range negatives {
+		if neg.Width() < width || neg.Height() < height {
+			return nil, fmt.Errorf("negative %d: dimensions %dx%d are too small", i,
+				neg.Width(), neg.Height())
+		}
+	}
 	return &imageSampleSource{
-		positives: pos,
-		negatives: neg,
+		positives: positives,
+		negatives: negatives,
 	}, nil
 }
 
-func readImage(imgPath string) (*DualImage, error) {
+// MirrorPositives creates a SampleSource which adds a
+// horizontally mirrored copy of every positive sample
+// from s.
+//
+// This is useful for objects which are symmetric, or
+// which come in mirrored pairs (see Cascade.Mirrored).
+func MirrorPositives(s SampleSource) SampleSource {
+	return &mirroredSampleSource{SampleSource: s}
+}
+
+type mirroredSampleSource struct {
+	SampleSource
+
+	once      sync.Once
+	positives []IntegralImage
+}
+
+func (m *mirroredSampleSource) Positives() []IntegralImage {
+	m.once.Do(func() {
+		original := m.SampleSource.Positives()
+		m.positives = append([]IntegralImage{}, original...)
+		for _, sample := range original {
+			m.positives = append(m.positives, MirrorImage(sample))
+		}
+	})
+	return m.positives
+}
+
+// ReadDualImage reads a PNG or JPEG file and converts it
+// to a grayscale DualImage.
+func ReadDualImage(imgPath string) (*DualImage, error) {
 	f, err := os.Open(imgPath)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,497 @@
+package haar
+
+import (
+	"context"
+	"image"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// These are defaults recommended in the original
+// Viola-Jones paper on face detection.
+const (
+	DefaultScanScale  = 1.25
+	DefaultScanStride = 1
+)
+
+// A ScanMode determines how a Cascade is applied to an
+// image at scales other than its native window size.
+type ScanMode int
+
+const (
+	// ScaleWindows crops each window out of the original
+	// image and scales it with ScaleIntegralImage.
+	ScaleWindows ScanMode = iota
+
+	// ScalePyramid downsamples the image once per scale
+	// using area-averaging, and then runs the cascade at
+	// its native window size on each downsampled image.
+	// This is more accurate than ScaleWindows, and it is
+	// faster for cascades with many features, since each
+	// feature evaluation is cheaper.
+	// However, it costs extra time and memory to build
+	// the downsampled images.
+	ScalePyramid
+
+	// ScaleFeatures scales every feature of the cascade
+	// once per scale (see Cascade.Scaled), and then runs
+	// the scaled cascade directly on windows of the
+	// original image.
+	// This avoids the overhead of ScaleIntegralImage
+	// without building any new images.
+	ScaleFeatures
+)
+
+// ScanOptions specifies how a Cascade should scan an
+// image.
+//
+// The zero value of ScanOptions scans the entire image
+// with the default scale and stride.
+type ScanOptions struct {
+	// Scale is the factor by which the cascade's window
+	// grows from one scale to the next.
+	// If Scale is 0, DefaultScanScale is used.
+	Scale float64
+
+	// StrideX and StrideY specify how many pixels
+	// (relative to the size of the cascade) to move the
+	// window horizontally and vertically for each
+	// iteration of the scanning process.
+	// If either is 0, DefaultScanStride is used for it.
+	StrideX float64
+	StrideY float64
+
+	// MinStep is the minimum number of whole pixels by
+	// which the window is moved in either direction.
+	// If MinStep is 0, there is no minimum.
+	MinStep int
+
+	// Region is the region of interest in the image.
+	// Only windows lying entirely inside the region are
+	// scanned.
+	// If Region is empty, the entire image is scanned.
+	Region image.Rectangle
+
+	// MinSize is the minimum size of objects to detect,
+	// in pixels.
+	// Windows narrower than MinSize.X or shorter than
+	// MinSize.Y are skipped.
+	MinSize image.Point
+
+	// MaxSize is the maximum size of objects to detect,
+	// in pixels.
+	// Windows wider than MaxSize.X or taller than
+	// MaxSize.Y are skipped.
+	// Zero components of MaxSize impose no limit.
+	MaxSize image.Point
+
+	// Workers is the number of goroutines to scan with.
+	// If Workers is 0, the scan is done on the calling
+	// goroutine.
+	// The result does not depend on Workers.
+	Workers int
+
+	// Mode determines how the cascade is scaled.
+	Mode ScanMode
+
+	// CoarseFirst indicates that the largest scales
+	// should be scanned first, so that a partial result
+	// still covers the whole image (at a coarse
+	// granularity).
+	// In this case, the matches are ordered from the
+	// largest scale to the smallest.
+	CoarseFirst bool
+
+	// Format is the IntegralFormat of the images which
+	// are built while scanning, such as the downsampled
+	// images in ScalePyramid mode and the rotated images
+	// in ScanRotated.
+	// Like with NewDualImage, the default is
+	// Float64Integrals, regardless of the format of the
+	// scanned image.
+	// The scanned image itself is always read in its own
+	// format.
+	Format IntegralFormat
+}
+
+// Scan looks for instances of this cascade within an
+// entire image.
+//
+// The cascade is scaled by various powers of scale to
+// find objects of different sizes.
+// If scale is 0, DefaultScanScale is used.
+//
+// The cascade is moved horizontally and vertically
+// during scanning according to the stride argument.
+// If the stride is 0, DefaultScanStride is used.
+// The stride specifies how many pixels (relative to the
+// size of the cascade) to move the cascade for each
+// iteration of the scanning process.
+// A value of 1 means that the unscaled cascade is moved
+// one pixel at a time.
+//
+// The result may contain overlapping matches.
+// Each match records its score, layer sums, and the scale
+// at which it was found.
+func (c *Cascade) Scan(img *DualImage, scale, stride float64) Matches {
+	res, _ := c.ScanWithOptions(context.Background(), img, &ScanOptions{
+		Scale:   scale,
+		StrideX: stride,
+		StrideY: stride,
+	})
+	return res
+}
+
+// ScanParallel is like Scan, but it splits the work up
+// between multiple goroutines.
+//
+// If workers is 0, runtime.GOMAXPROCS(0) is used.
+//
+// The result is identical to the result of Scan,
+// including the order of the matches.
+func (c *Cascade) ScanParallel(img *DualImage, scale, stride float64, workers int) Matches {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	res, _ := c.ScanWithOptions(context.Background(), img, &ScanOptions{
+		Scale:   scale,
+		StrideX: stride,
+		StrideY: stride,
+		Workers: workers,
+	})
+	return res
+}
+
+// ScanContext is like Scan, but it stops early if the
+// context is cancelled or its deadline passes.
+//
+// If the scan is cut short, the matches found so far are
+// returned along with the context's error.
+// Otherwise, the error is nil.
+//
+// If coarseFirst is true, the largest scales are scanned
+// first, so that a partial result still covers the whole
+// image (at a coarse granularity).
+// In this case, the matches are ordered from the largest
+// scale to the smallest.
+func (c *Cascade) ScanContext(ctx context.Context, img *DualImage, scale, stride float64,
+	coarseFirst bool) (Matches, error) {
+	return c.ScanWithOptions(ctx, img, &ScanOptions{
+		Scale:       scale,
+		StrideX:     stride,
+		StrideY:     stride,
+		CoarseFirst: coarseFirst,
+	})
+}
+
+// ScanWithOptions looks for instances of this cascade
+// within an image according to the given options.
+// If opts is nil, the default options are used.
+//
+// Like ScanContext, this stops early if the context is
+// done, returning the matches found so far along with
+// the context's error.
+func (c *Cascade) ScanWithOptions(ctx context.Context, img *DualImage,
+	opts *ScanOptions) (Matches, error) {
+	if opts == nil {
+		opts = &ScanOptions{}
+	}
+	return scanImage(ctx, c, img, opts)
+}
+
+// A scanClassifier is a cascade-like classifier which can
+// be used to scan an image.
+type scanClassifier interface {
+	Sums(img IntegralImage) (sums []float64, ok bool)
+	Score(sums []float64) float64
+
+	windowSize() (width, height int)
+	scaledClassifier(width, height int) scanClassifier
+}
+
+func scanImage(ctx context.Context, s scanClassifier, img *DualImage,
+	opts *ScanOptions) (Matches, error) {
+	levels := classifierScanLevels(s, img, opts)
+	return runScan(ctx, levels, opts, func(level *scanLevel, y int) Matches {
+		return scanRow(s, img, level, y)
+	})
+}
+
+// runScan scans every row of every level with scanRow,
+// taking into account the workers and ordering options.
+//
+// Levels are scanned one at a time.
+// The downsampled image for a pyramid level is built
+// right before the level is scanned, and it is released
+// once the level is done, so that only one is kept in
+// memory at a time.
+func runScan(ctx context.Context, levels []*scanLevel, opts *ScanOptions,
+	scanRow func(level *scanLevel, y int) Matches) (Matches, error) {
+	if opts.CoarseFirst {
+		for i := 0; i < len(levels)/2; i++ {
+			levels[i], levels[len(levels)-(i+1)] = levels[len(levels)-(i+1)], levels[i]
+		}
+	}
+
+	var res Matches
+	for _, level := range levels {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		if level.buildPyramid != nil {
+			level.pyramid = level.buildPyramid()
+		}
+		var err error
+		if opts.Workers > 1 {
+			res, err = runLevelParallel(ctx, level, opts.Workers, scanRow, res)
+		} else {
+			res, err = runLevel(ctx, level, scanRow, res)
+		}
+		if level.buildPyramid != nil {
+			level.pyramid = nil
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// runLevel scans every row of a level, appending the
+// matches to res.
+func runLevel(ctx context.Context, level *scanLevel,
+	scanRow func(level *scanLevel, y int) Matches, res Matches) (Matches, error) {
+	for _, y := range level.rows {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		res = append(res, scanRow(level, y)...)
+	}
+	return res, nil
+}
+
+// runLevelParallel is like runLevel, but it splits the
+// rows between multiple goroutines.
+func runLevelParallel(ctx context.Context, level *scanLevel, workers int,
+	scanRow func(level *scanLevel, y int) Matches, res Matches) (Matches, error) {
+	rowChan := make(chan int, len(level.rows))
+	for i := range level.rows {
+		rowChan <- i
+	}
+	close(rowChan)
+
+	rowMatches := make([]Matches, len(level.rows))
+	rowDone := make([]bool, len(level.rows))
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range rowChan {
+				if ctx.Err() != nil {
+					return
+				}
+				rowMatches[idx] = scanRow(level, level.rows[idx])
+				rowDone[idx] = true
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, matches := range rowMatches {
+		if rowDone[i] {
+			res = append(res, matches...)
+		}
+	}
+	return res, ctx.Err()
+}
+
+// A scanLevel stores the information needed to scan an
+// image at a single scale.
+type scanLevel struct {
+	scale  float64
+	width  int
+	height int
+
+	// rows contains the y coordinate of every row of
+	// windows at this level.
+	rows []int
+
+	// columns contains the x coordinate of every window
+	// in a row.
+	columns []int
+
+	// pyramid is the downsampled image for this level
+	// when scanning in ScalePyramid mode.
+	// It is only set while runScan is scanning the level,
+	// and buildPyramid creates it.
+	// In this case, rows and columns are coordinates in
+	// the downsampled image, and xScale and yScale map
+	// them back to the original image.
+	pyramid      *DualImage
+	buildPyramid func() *DualImage
+	xScale       float64
+	yScale       float64
+
+	// scaled is the scaled classifier for this level when
+	// scanning in ScaleFeatures mode.
+	scaled scanClassifier
+}
+
+func classifierScanLevels(s scanClassifier, img *DualImage,
+	opts *ScanOptions) []*scanLevel {
+	width, height := s.windowSize()
+	levels := scanLevels(img, width, height, opts)
+	switch opts.Mode {
+	case ScalePyramid:
+		var res []*scanLevel
+		for _, level := range levels {
+			if level.scale == 1 || pyramidLevel(s, img, level, opts) {
+				res = append(res, level)
+			}
+		}
+		return res
+	case ScaleFeatures:
+		for _, level := range levels {
+			if level.scale != 1 {
+				level.scaled = s.scaledClassifier(level.width, level.height)
+			}
+		}
+	}
+	return levels
+}
+
+// scanLevels computes the levels for scanning an image
+// with a window of the given native size.
+// The levels are set up for ScaleWindows mode.
+func scanLevels(img *DualImage, windowWidth, windowHeight int,
+	opts *ScanOptions) []*scanLevel {
+	scale, strideX, strideY, region := opts.resolve(img)
+
+	var res []*scanLevel
+	for curScale := 1.0; ; curScale *= scale {
+		level := &scanLevel{
+			scale:  curScale,
+			width:  int(float64(windowWidth)*curScale + 0.5),
+			height: int(float64(windowHeight)*curScale + 0.5),
+		}
+		if level.width > region.Dx() || level.height > region.Dy() {
+			break
+		}
+		if (opts.MaxSize.X != 0 && level.width > opts.MaxSize.X) ||
+			(opts.MaxSize.Y != 0 && level.height > opts.MaxSize.Y) {
+			break
+		}
+		if level.width < opts.MinSize.X || level.height < opts.MinSize.Y {
+			continue
+		}
+		level.rows = scanPositions(region.Min.Y, region.Max.Y-level.height,
+			math.Max(curScale*strideY, float64(opts.MinStep)))
+		level.columns = scanPositions(region.Min.X, region.Max.X-level.width,
+			math.Max(curScale*strideX, float64(opts.MinStep)))
+		res = append(res, level)
+	}
+	return res
+}
+
+// resolve fills in the defaults for the scale, strides,
+// and region of interest.
+func (o *ScanOptions) resolve(img *DualImage) (scale, strideX, strideY float64,
+	region image.Rectangle) {
+	scale, strideX, strideY = o.Scale, o.StrideX, o.StrideY
+	if scale == 0 {
+		scale = DefaultScanScale
+	}
+	if strideX == 0 {
+		strideX = DefaultScanStride
+	}
+	if strideY == 0 {
+		strideY = DefaultScanStride
+	}
+	region = image.Rect(0, 0, img.Width(), img.Height())
+	if !o.Region.Empty() {
+		region = region.Intersect(o.Region)
+	}
+	return
+}
+
+// pyramidLevel sets up a level for ScalePyramid mode.
+// It returns false if the level should be skipped.
+func pyramidLevel(s scanClassifier, img *DualImage, level *scanLevel,
+	opts *ScanOptions) bool {
+	windowWidth, windowHeight := s.windowSize()
+	width := int(float64(img.Width()) / level.scale)
+	height := int(float64(img.Height()) / level.scale)
+	if width < windowWidth || height < windowHeight {
+		return false
+	}
+	level.buildPyramid = func() *DualImage {
+		return img.resize(width, height, opts.Format)
+	}
+	level.xScale = float64(img.Width()) / float64(width)
+	level.yScale = float64(img.Height()) / float64(height)
+
+	_, strideX, strideY, region := opts.resolve(img)
+	minX := int(math.Ceil(float64(region.Min.X) / level.xScale))
+	minY := int(math.Ceil(float64(region.Min.Y) / level.yScale))
+	maxX := int(float64(region.Max.X) / level.xScale)
+	maxY := int(float64(region.Max.Y) / level.yScale)
+	level.rows = scanPositions(minY, maxY-windowHeight,
+		math.Max(strideY, float64(opts.MinStep)/level.yScale))
+	level.columns = scanPositions(minX, maxX-windowWidth,
+		math.Max(strideX, float64(opts.MinStep)/level.xScale))
+	return len(level.rows) > 0 && len(level.columns) > 0
+}
+
+func scanPositions(start, end int, step float64) []int {
+	// Counting the positions first keeps the number of
+	// allocations independent of the image size.
+	var count int
+	for offset := 0.0; start+int(offset) <= end; offset += step {
+		count++
+	}
+	res := make([]int, 0, count)
+	for offset := 0.0; start+int(offset) <= end; offset += step {
+		res = append(res, start+int(offset))
+	}
+	return res
+}
+
+func scanRow(s scanClassifier, img *DualImage, level *scanLevel, y int) Matches {
+	windowWidth, windowHeight := s.windowSize()
+	classifier := s
+	if level.scaled != nil {
+		classifier = level.scaled
+	}
+
+	var res Matches
+	for _, x := range level.columns {
+		var cropping IntegralImage
+		matchX, matchY := x, y
+		if level.buildPyramid != nil {
+			cropping = level.pyramid.Window(x, y, windowWidth, windowHeight)
+			matchX = int(float64(x)*level.xScale + 0.5)
+			matchY = int(float64(y)*level.yScale + 0.5)
+		} else {
+			cropping = img.Window(x, y, level.width, level.height)
+			if level.scale != 1 && level.scaled == nil {
+				cropping = ScaleIntegralImage(cropping, windowWidth, windowHeight)
+			}
+		}
+		if sums, ok := classifier.Sums(cropping); ok {
+			res = append(res, &Match{
+				X:         matchX,
+				Y:         matchY,
+				Width:     level.width,
+				Height:    level.height,
+				Score:     classifier.Score(sums),
+				LayerSums: sums,
+				Scale:     level.scale,
+				Count:     1,
+			})
+		}
+	}
+	return res
+}
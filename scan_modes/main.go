@@ -0,0 +1,107 @@
+// Command scan_modes compares the speed and output of the
+// different cascade scanning modes on a set of images.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/unixpickle/haar"
+)
+
+const OverlapThreshold = 0.7
+
+var modes = []haar.ScanMode{haar.ScaleWindows, haar.ScalePyramid, haar.ScaleFeatures}
+
+var modeNames = map[haar.ScanMode]string{
+	haar.ScaleWindows:  "windows",
+	haar.ScalePyramid:  "pyramid",
+	haar.ScaleFeatures: "features",
+}
+
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintf(os.Stderr, "Usage: %s cascade_file image_dir\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	cascadeData, err := ioutil.ReadFile(os.Args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read cascade:", err)
+		os.Exit(1)
+	}
+	var cascade haar.Cascade
+	if err := json.Unmarshal(cascadeData, &cascade); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse cascade:", err)
+		os.Exit(1)
+	}
+
+	listing, err := ioutil.ReadDir(os.Args[2])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read directory:", err)
+		os.Exit(1)
+	}
+
+	durations := map[haar.ScanMode]time.Duration{}
+	rawCounts := map[haar.ScanMode]int{}
+	joinedCounts := map[haar.ScanMode]int{}
+	agreements := map[haar.ScanMode]int{}
+
+	for _, item := range listing {
+		if strings.HasPrefix(item.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(os.Args[2], item.Name())
+		f, err := os.Open(path)
+		if err != nil {
+			log.Printf("Failed to read: %s: %s", path, err)
+			continue
+		}
+		img, _, err := image.Decode(f)
+		f.Close()
+		if err != nil {
+			log.Printf("Failed to decode: %s: %s", path, err)
+			continue
+		}
+		dualImg := haar.NewDualImage(haar.ImageIntegralImage(img))
+
+		var reference haar.Matches
+		for _, mode := range modes {
+			start := time.Now()
+			matches, _ := cascade.ScanWithOptions(context.Background(), dualImg,
+				&haar.ScanOptions{Mode: mode})
+			durations[mode] += time.Since(start)
+			rawCounts[mode] += len(matches)
+
+			joined := matches.JoinOverlaps(OverlapThreshold)
+			joinedCounts[mode] += len(joined)
+			if mode == haar.ScaleWindows {
+				reference = joined
+			}
+			for _, match := range joined {
+				if reference.MaxOverlap(match) > OverlapThreshold {
+					agreements[mode]++
+				}
+			}
+		}
+	}
+
+	for _, mode := range modes {
+		var agreement float64
+		if joinedCounts[mode] > 0 {
+			agreement = float64(agreements[mode]) / float64(joinedCounts[mode])
+		}
+		log.Printf("%s: time=%s raw=%d joined=%d agreement=%f", modeNames[mode],
+			durations[mode], rawCounts[mode], joinedCounts[mode], agreement)
+	}
+}
@@ -0,0 +1,383 @@
+package haar
+
+import (
+	"context"
+	"image"
+	"math/rand"
+	"testing"
+)
+
+func TestCascadeSums(t *testing.T) {
+	cascade := scanTestCascade()
+	img := NewDualImage(scanTestImage(8, 8, 1))
+	window := img.Window(0, 0, 8, 8)
+
+	sums, ok := cascade.Sums(window)
+	if ok != cascade.Classify(window) {
+		t.Fatalf("Sums returned %v but Classify returned %v", ok, !ok)
+	}
+	for i, sum := range sums {
+		if expected := cascade.Layers[i].Sum(window); sum != expected {
+			t.Errorf("layer %d: expected sum %f got %f", i, expected, sum)
+		}
+	}
+	if ok && len(sums) != len(cascade.Layers) {
+		t.Errorf("expected %d sums but got %d", len(cascade.Layers), len(sums))
+	}
+}
+
+func TestScanScores(t *testing.T) {
+	cascade := scanTestCascade()
+	img := NewDualImage(scanTestImage(40, 30, 2))
+	matches := cascade.Scan(img, 0, 0)
+	if len(matches) == 0 {
+		t.Fatal("expected some matches")
+	}
+	for _, match := range matches {
+		if match.Score <= 0 {
+			t.Errorf("match %v has non-positive score %f", match, match.Score)
+		}
+		if len(match.LayerSums) != len(cascade.Layers) {
+			t.Errorf("match %v has %d layer sums", match, len(match.LayerSums))
+		}
+		if match.Count != 1 {
+			t.Errorf("match %v has count %d", match, match.Count)
+		}
+		expectedWidth := int(float64(cascade.WindowWidth)*match.Scale + 0.5)
+		if match.Width != expectedWidth {
+			t.Errorf("match %v has scale %f", match, match.Scale)
+		}
+	}
+}
+
+func TestScanParallel(t *testing.T) {
+	cascade := scanTestCascade()
+	img := NewDualImage(scanTestImage(50, 37, 3))
+	expected := cascade.Scan(img, 1.1, 1.5)
+	for _, workers := range []int{0, 1, 3, 16} {
+		actual := cascade.ScanParallel(img, 1.1, 1.5, workers)
+		if !scanTestMatchesEqual(expected, actual) {
+			t.Errorf("workers=%d: expected %v got %v", workers, expected, actual)
+		}
+	}
+}
+
+func TestScanContext(t *testing.T) {
+	cascade := scanTestCascade()
+	img := NewDualImage(scanTestImage(50, 37, 3))
+	expected := cascade.Scan(img, 1.1, 1.5)
+
+	actual, err := cascade.ScanContext(context.Background(), img, 1.1, 1.5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !scanTestMatchesEqual(expected, actual) {
+		t.Errorf("expected %v got %v", expected, actual)
+	}
+
+	coarse, err := cascade.ScanContext(context.Background(), img, 1.1, 1.5, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(coarse) != len(expected) {
+		t.Fatalf("coarse scan gave %d matches but expected %d", len(coarse), len(expected))
+	}
+	for i := 1; i < len(coarse); i++ {
+		if coarse[i].Scale > coarse[i-1].Scale {
+			t.Fatalf("match %d has larger scale than its predecessor", i)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cancelled, err := cascade.ScanContext(ctx, img, 1.1, 1.5, true)
+	if err != context.Canceled {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+	if len(cancelled) != 0 {
+		t.Errorf("expected no matches but got %d", len(cancelled))
+	}
+}
+
+func TestScanOptions(t *testing.T) {
+	cascade := scanTestCascade()
+	img := NewDualImage(scanTestImage(60, 45, 5))
+	ctx := context.Background()
+
+	nativeSize := image.Pt(cascade.WindowWidth, cascade.WindowHeight)
+	full, _ := cascade.ScanWithOptions(ctx, img, &ScanOptions{MaxSize: nativeSize})
+	region := image.Rect(7, 5, 40, 33)
+	cropped, err := cascade.ScanWithOptions(ctx, img, &ScanOptions{
+		MaxSize: nativeSize,
+		Region:  region,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected Matches
+	for _, m := range full {
+		if image.Rect(m.X, m.Y, m.X+m.Width, m.Y+m.Height).In(region) {
+			expected = append(expected, m)
+		}
+	}
+	if len(expected) == 0 || !scanTestMatchesEqual(expected, cropped) {
+		t.Errorf("region scan: expected %v got %v", expected, cropped)
+	}
+
+	strided, _ := cascade.ScanWithOptions(ctx, img, &ScanOptions{
+		MaxSize: nativeSize,
+		StrideX: 2,
+		StrideY: 3,
+	})
+	if len(strided) == 0 {
+		t.Error("strided scan gave no matches")
+	}
+	for _, m := range strided {
+		if m.X%2 != 0 || m.Y%3 != 0 {
+			t.Errorf("unexpected strided match: %v", m)
+		}
+	}
+
+	stepped, _ := cascade.ScanWithOptions(ctx, img, &ScanOptions{
+		MaxSize: nativeSize,
+		StrideX: 0.5,
+		StrideY: 0.5,
+		MinStep: 1,
+	})
+	if !scanTestMatchesEqual(full, stepped) {
+		t.Errorf("min step: expected %v got %v", full, stepped)
+	}
+
+	sized, _ := cascade.ScanWithOptions(ctx, img, &ScanOptions{
+		MinSize: image.Pt(12, 12),
+		MaxSize: image.Pt(20, 20),
+	})
+	if len(sized) == 0 {
+		t.Error("sized scan gave no matches")
+	}
+	for _, m := range sized {
+		if m.Width < 12 || m.Height < 12 || m.Width > 20 || m.Height > 20 {
+			t.Errorf("unexpected match size: %v", m)
+		}
+	}
+}
+
+func TestScanPyramid(t *testing.T) {
+	cascade := scanTestCascade()
+	img := NewDualImage(scanTestImage(60, 45, 6))
+	ctx := context.Background()
+
+	nativeSize := image.Pt(cascade.WindowWidth, cascade.WindowHeight)
+	expected, _ := cascade.ScanWithOptions(ctx, img, &ScanOptions{MaxSize: nativeSize})
+	actual, _ := cascade.ScanWithOptions(ctx, img, &ScanOptions{
+		MaxSize: nativeSize,
+		Mode:    ScalePyramid,
+	})
+	if !scanTestMatchesEqual(expected, actual) {
+		t.Errorf("native scale: expected %v got %v", expected, actual)
+	}
+
+	region := image.Rect(3, 4, 55, 41)
+	matches, _ := cascade.ScanWithOptions(ctx, img, &ScanOptions{
+		Mode:    ScalePyramid,
+		Region:  region,
+		MinSize: image.Pt(10, 10),
+	})
+	if len(matches) == 0 {
+		t.Fatal("expected some matches")
+	}
+	for _, m := range matches {
+		if m.Width < 10 || m.Height < 10 {
+			t.Errorf("match %v is too small", m)
+		}
+		// Rounding may push a match one pixel outside the
+		// region.
+		if !image.Rect(m.X, m.Y, m.X+m.Width, m.Y+m.Height).In(region.Inset(-1)) {
+			t.Errorf("match %v is outside of region", m)
+		}
+	}
+}
+
+func TestScanPyramidLazy(t *testing.T) {
+	cascade := scanTestCascade()
+	img := NewDualImage(scanTestImage(60, 45, 6))
+	for _, workers := range []int{0, 2} {
+		opts := &ScanOptions{Mode: ScalePyramid, Workers: workers}
+		levels := classifierScanLevels(cascade, img, opts)
+		if len(levels) < 3 {
+			t.Fatalf("expected at least 3 levels but got %d", len(levels))
+		}
+		var built int
+		for _, level := range levels[1:] {
+			build := level.buildPyramid
+			level.buildPyramid = func() *DualImage {
+				built++
+				return build()
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err := runScan(ctx, levels, opts, func(level *scanLevel, y int) Matches {
+			if level.buildPyramid != nil {
+				if level.pyramid == nil {
+					t.Error("pyramid was not built before scanning")
+				}
+				cancel()
+			}
+			return scanRow(cascade, img, level, y)
+		})
+		if err != context.Canceled {
+			t.Errorf("expected context.Canceled but got %v", err)
+		}
+		if built != 1 {
+			t.Errorf("workers %d: expected 1 pyramid image but got %d", workers, built)
+		}
+		for _, level := range levels {
+			if level.pyramid != nil {
+				t.Error("pyramid image was not released")
+			}
+		}
+	}
+}
+
+func TestScanFormat(t *testing.T) {
+	cascade := scanTestCascade()
+	img := NewDualImageFormat(scanTestImage(60, 45, 6), Float32Integrals)
+	formats := []IntegralFormat{Float64Integrals, Float32Integrals, Uint32Integrals}
+	for _, format := range formats {
+		opts := &ScanOptions{Mode: ScalePyramid, Format: format}
+		levels := classifierScanLevels(cascade, img, opts)
+		if len(levels) < 2 {
+			t.Fatalf("expected multiple levels but got %d", len(levels))
+		}
+		for _, level := range levels[1:] {
+			if f := level.buildPyramid().Format(); f != format {
+				t.Errorf("expected format %d but got %d", format, f)
+			}
+		}
+		matches, _ := cascade.ScanWithOptions(context.Background(), img, opts)
+		if len(matches) == 0 {
+			t.Errorf("format %d: expected some matches", format)
+		}
+	}
+}
+
+func TestScanFeatures(t *testing.T) {
+	cascade := scanTestCascade()
+	img := NewDualImage(scanTestImage(60, 45, 7))
+	ctx := context.Background()
+
+	nativeSize := image.Pt(cascade.WindowWidth, cascade.WindowHeight)
+	expected, _ := cascade.ScanWithOptions(ctx, img, &ScanOptions{MaxSize: nativeSize})
+	actual, _ := cascade.ScanWithOptions(ctx, img, &ScanOptions{
+		MaxSize: nativeSize,
+		Mode:    ScaleFeatures,
+	})
+	if !scanTestMatchesEqual(expected, actual) {
+		t.Errorf("native scale: expected %v got %v", expected, actual)
+	}
+
+	matches, _ := cascade.ScanWithOptions(ctx, img, &ScanOptions{
+		Mode:    ScaleFeatures,
+		MinSize: image.Pt(10, 10),
+	})
+	if len(matches) == 0 {
+		t.Fatal("expected some matches")
+	}
+	for _, m := range matches {
+		if m.Width < 10 || m.Height < 10 || m.X+m.Width > 60 || m.Y+m.Height > 45 {
+			t.Errorf("unexpected match: %v", m)
+		}
+	}
+}
+
+func BenchmarkScan(b *testing.B) {
+	cascade := scanTestCascade()
+	img := NewDualImage(scanTestImage(320, 240, 4))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cascade.Scan(img, 0, 0)
+	}
+}
+
+func BenchmarkScanParallel(b *testing.B) {
+	cascade := scanTestCascade()
+	img := NewDualImage(scanTestImage(320, 240, 4))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cascade.ScanParallel(img, 0, 0, 0)
+	}
+}
+
+func BenchmarkScanPyramid(b *testing.B) {
+	cascade := scanTestCascade()
+	img := NewDualImage(scanTestImage(320, 240, 4))
+	opts := &ScanOptions{Mode: ScalePyramid}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cascade.ScanWithOptions(context.Background(), img, opts)
+	}
+}
+
+func BenchmarkScanFeatures(b *testing.B) {
+	cascade := scanTestCascade()
+	img := NewDualImage(scanTestImage(320, 240, 4))
+	opts := &ScanOptions{Mode: ScaleFeatures}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cascade.ScanWithOptions(context.Background(), img, opts)
+	}
+}
+
+// scanTestCascade creates a small hand-made cascade which
+// accepts a reasonable fraction of random windows.
+func scanTestCascade() *Cascade {
+	return &Cascade{
+		WindowWidth:  8,
+		WindowHeight: 8,
+		Layers: []*Layer{
+			{
+				Features: []WindowFeature{
+					&Feature{HorizontalPair, 0, 0, 8, 8},
+					&Feature{VerticalPair, 0, 0, 8, 8},
+				},
+				Thresholds: []float64{3, 1},
+				Weights:    []float64{1, 0.5},
+				Threshold:  1.2,
+			},
+			{
+				Features: []WindowFeature{
+					&Feature{Diagonal, 2, 2, 4, 4},
+					&Feature{HorizontalTriple, 1, 1, 6, 3},
+					&Feature{VerticalTriple, 0, 1, 4, 6},
+				},
+				Thresholds: []float64{0, -1, 0.5},
+				Weights:    []float64{0.7, 0.4, 0.2},
+				Threshold:  -0.5,
+			},
+		},
+	}
+}
+
+func scanTestImage(width, height int, seed int64) IntegralImage {
+	gen := rand.New(rand.NewSource(seed))
+	pixels := make([]float64, width*height)
+	for i := range pixels {
+		pixels[i] = gen.Float64()
+	}
+	return BitmapIntegralImage(pixels, width, height)
+}
+
+func scanTestMatchesEqual(m1, m2 Matches) bool {
+	if len(m1) != len(m2) {
+		return false
+	}
+	for i, x := range m1 {
+		y := m2[i]
+		if x.X != y.X || x.Y != y.Y || x.Width != y.Width || x.Height != y.Height ||
+			x.Score != y.Score || x.Scale != y.Scale {
+			return false
+		}
+	}
+	return true
+}
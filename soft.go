@@ -0,0 +1,218 @@
+package haar
+
+import (
+	"context"
+	"math"
+)
+
+// A SoftCascade is a cascade which can reject a window
+// after any feature, rather than only at the end of each
+// layer.
+//
+// Since most windows are obviously negative after a few
+// features, a SoftCascade can be much cheaper to run than
+// the equivalent Cascade.
+type SoftCascade struct {
+	Layers       []*SoftLayer
+	WindowWidth  int
+	WindowHeight int
+}
+
+// A SoftLayer is a Layer with a rejection threshold after
+// every feature.
+type SoftLayer struct {
+	Layer *Layer
+
+	// Rejections contains one threshold per feature.
+	// After computing the partial sum of the first i+1
+	// features, a window is rejected if the partial sum
+	// is less than or equal to Rejections[i].
+	//
+	// The final rejection threshold should be at least
+	// the layer's Threshold.
+	Rejections []float64
+}
+
+// NewSoftCascade converts a Cascade into a SoftCascade.
+//
+// The rejection thresholds are set so that a window is
+// only rejected once the remaining features could not
+// possibly push it over the layer's threshold.
+// Thus, the SoftCascade classifies every window the same
+// way as c, while doing less work.
+// Use Calibrate to set more aggressive thresholds.
+func NewSoftCascade(c *Cascade) *SoftCascade {
+	res := &SoftCascade{
+		Layers:       make([]*SoftLayer, len(c.Layers)),
+		WindowWidth:  c.WindowWidth,
+		WindowHeight: c.WindowHeight,
+	}
+	for i, layer := range c.Layers {
+		res.Layers[i] = &SoftLayer{
+			Layer:      layer,
+			Rejections: boundRejections(layer),
+		}
+	}
+	return res
+}
+
+// Sum computes the layer's sum on an image window.
+// If the window is rejected before the final feature,
+// the partial sum is returned and ok is false.
+func (s *SoftLayer) Sum(img IntegralImage) (sum float64, ok bool) {
+	for i, rejection := range s.Rejections {
+		sum += s.Layer.output(i, img)
+		if sum <= rejection {
+			return sum, false
+		}
+	}
+	return sum, sum > s.Layer.Threshold
+}
+
+// Classify runs the layer on an image.
+// It returns true if the sample is positive.
+func (s *SoftLayer) Classify(img IntegralImage) bool {
+	_, ok := s.Sum(img)
+	return ok
+}
+
+// Classify classifies the given window by running it
+// through the cascade.
+// If the result is positive, this returns true.
+func (s *SoftCascade) Classify(img IntegralImage) bool {
+	for _, layer := range s.Layers {
+		if !layer.Classify(img) {
+			return false
+		}
+	}
+	return true
+}
+
+// Sums is like Cascade.Sums.
+// If a window is rejected partway through a layer, the
+// final sum is the partial sum for that layer.
+func (s *SoftCascade) Sums(img IntegralImage) (sums []float64, ok bool) {
+	sums = make([]float64, 0, len(s.Layers))
+	for _, layer := range s.Layers {
+		sum, ok := layer.Sum(img)
+		sums = append(sums, sum)
+		if !ok {
+			return sums, false
+		}
+	}
+	return sums, true
+}
+
+// Score is like Cascade.Score.
+func (s *SoftCascade) Score(sums []float64) float64 {
+	if len(s.Layers) == 0 {
+		return 0
+	}
+	last := len(s.Layers) - 1
+	return sums[last] - s.Layers[last].Layer.Threshold
+}
+
+// Calibrate sets the rejection thresholds of every layer
+// using a set of positive samples.
+//
+// Each rejection threshold is set as high as possible
+// without rejecting any of the positives which the
+// cascade currently accepts.
+// This is known as direct backward pruning.
+// The final threshold of each layer is never lowered
+// below the layer's Threshold.
+//
+// If none of the positives are accepted, the cascade is
+// left unchanged.
+func (s *SoftCascade) Calibrate(positives []IntegralImage) {
+	var accepted []IntegralImage
+	for _, positive := range positives {
+		if s.Classify(positive) {
+			accepted = append(accepted, positive)
+		}
+	}
+	if len(accepted) == 0 {
+		return
+	}
+
+	for _, layer := range s.Layers {
+		minSums := make([]float64, len(layer.Rejections))
+		for i := range minSums {
+			minSums[i] = math.Inf(1)
+		}
+		for _, positive := range accepted {
+			var sum float64
+			for i := range minSums {
+				sum += layer.Layer.output(i, positive)
+				minSums[i] = math.Min(minSums[i], sum)
+			}
+		}
+		for i, minSum := range minSums {
+			layer.Rejections[i] = math.Nextafter(minSum, math.Inf(-1))
+		}
+		if last := len(minSums) - 1; last >= 0 {
+			layer.Rejections[last] = math.Max(layer.Rejections[last], layer.Layer.Threshold)
+		}
+	}
+}
+
+// Scan is like Cascade.Scan, but for a soft cascade.
+func (s *SoftCascade) Scan(img *DualImage, scale, stride float64) Matches {
+	res, _ := s.ScanWithOptions(context.Background(), img, &ScanOptions{
+		Scale:   scale,
+		StrideX: stride,
+		StrideY: stride,
+	})
+	return res
+}
+
+// ScanWithOptions is like Cascade.ScanWithOptions, but
+// for a soft cascade.
+func (s *SoftCascade) ScanWithOptions(ctx context.Context, img *DualImage,
+	opts *ScanOptions) (Matches, error) {
+	if opts == nil {
+		opts = &ScanOptions{}
+	}
+	return scanImage(ctx, s, img, opts)
+}
+
+// Scaled is like Cascade.Scaled, but for a soft cascade.
+// The rejection thresholds are preserved, since scaling
+// does not change the layers' weights.
+func (s *SoftCascade) Scaled(width, height int) *SoftCascade {
+	xScale := float64(width) / float64(s.WindowWidth)
+	yScale := float64(height) / float64(s.WindowHeight)
+	res := &SoftCascade{
+		Layers:       make([]*SoftLayer, len(s.Layers)),
+		WindowWidth:  width,
+		WindowHeight: height,
+	}
+	for i, layer := range s.Layers {
+		res.Layers[i] = &SoftLayer{
+			Layer:      layer.Layer.scaled(xScale, yScale, width, height),
+			Rejections: append([]float64{}, layer.Rejections...),
+		}
+	}
+	return res
+}
+
+func (s *SoftCascade) windowSize() (width, height int) {
+	return s.WindowWidth, s.WindowHeight
+}
+
+func (s *SoftCascade) scaledClassifier(width, height int) scanClassifier {
+	return s.Scaled(width, height)
+}
+
+// boundRejections computes the rejection thresholds for
+// a layer below which a window cannot possibly pass the
+// layer.
+func boundRejections(layer *Layer) []float64 {
+	res := make([]float64, len(layer.Features))
+	var remaining float64
+	for i := len(res) - 1; i >= 0; i-- {
+		res[i] = layer.Threshold - remaining
+		remaining += layer.maxOutput(i)
+	}
+	return res
+}
@@ -0,0 +1,76 @@
+package haar
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSoftCascadeLossless(t *testing.T) {
+	cascade := scanTestCascade()
+	soft := NewSoftCascade(cascade)
+	img := NewDualImage(scanTestImage(60, 45, 9))
+
+	for y := 0; y+cascade.WindowHeight <= img.Height(); y++ {
+		for x := 0; x+cascade.WindowWidth <= img.Width(); x++ {
+			window := img.Window(x, y, cascade.WindowWidth, cascade.WindowHeight)
+			if soft.Classify(window) != cascade.Classify(window) {
+				t.Fatalf("window %d,%d classified differently", x, y)
+			}
+		}
+	}
+
+	for _, mode := range []ScanMode{ScaleWindows, ScaleFeatures} {
+		opts := &ScanOptions{Mode: mode}
+		expected, _ := cascade.ScanWithOptions(context.Background(), img, opts)
+		actual, _ := soft.ScanWithOptions(context.Background(), img, opts)
+		if len(expected) == 0 || !scanTestMatchesEqual(expected, actual) {
+			t.Errorf("mode %d: expected %v got %v", mode, expected, actual)
+		}
+	}
+}
+
+func TestSoftCascadeCalibrate(t *testing.T) {
+	cascade := scanTestCascade()
+	soft := NewSoftCascade(cascade)
+	img := NewDualImage(scanTestImage(60, 45, 10))
+
+	var positives []IntegralImage
+	for _, match := range cascade.Scan(img, 0, 0) {
+		if match.Scale == 1 {
+			positives = append(positives, img.Window(match.X, match.Y, match.Width,
+				match.Height))
+		}
+	}
+	if len(positives) == 0 {
+		t.Fatal("no positives")
+	}
+
+	bounds := make([][]float64, len(soft.Layers))
+	for i, layer := range soft.Layers {
+		bounds[i] = append([]float64{}, layer.Rejections...)
+	}
+	soft.Calibrate(positives)
+
+	for i, positive := range positives {
+		if !soft.Classify(positive) {
+			t.Errorf("positive %d was rejected after calibration", i)
+		}
+	}
+	for i, layer := range soft.Layers {
+		for j, rejection := range layer.Rejections {
+			if rejection < bounds[i][j] {
+				t.Errorf("layer %d feature %d: threshold %f is below bound %f", i, j,
+					rejection, bounds[i][j])
+			}
+		}
+	}
+}
+
+func BenchmarkSoftCascadeScan(b *testing.B) {
+	soft := NewSoftCascade(scanTestCascade())
+	img := NewDualImage(scanTestImage(320, 240, 4))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		soft.Scan(img, 0, 0)
+	}
+}
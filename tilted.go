@@ -0,0 +1,89 @@
+package haar
+
+// A TiltedIntegralImage is an IntegralImage which can
+// also compute sums over regions rotated by 45 degrees.
+type TiltedIntegralImage interface {
+	IntegralImage
+
+	// TiltedIntegralAt returns the sum of the pixels in
+	// the triangle above the given coordinate.
+	// This triangle contains every pixel (px, py) with
+	// py < y and |px - x| < y - py.
+	//
+	// The x coordinate must be between 0 and Width(), and
+	// the y coordinate must be between 0 and Height().
+	// The triangle may extend past the left and right
+	// edges of the image, in which case it includes only
+	// the pixels inside the image.
+	//
+	// Like IntegralAt, the integral around the top of the
+	// image needn't be zero.
+	TiltedIntegralAt(x, y int) float64
+}
+
+// A tiltedTable stores the tilted integrals of an image
+// in a flat slice, with the same layout as the integrals
+// of a sliceIntegralImage.
+type tiltedTable struct {
+	integrals []float64
+	width     int
+	height    int
+}
+
+func newTiltedTable(pixels []float64, width, height int) *tiltedTable {
+	res := &tiltedTable{
+		integrals: make([]float64, (width+1)*(height+1)),
+		width:     width,
+		height:    height,
+	}
+
+	pixel := func(x, y int) float64 {
+		if x < 0 || x >= width {
+			return 0
+		}
+		return pixels[x+width*y]
+	}
+
+	// Each triangle extends the triangle above it by two
+	// diagonal lines, which meet at the bottom pixel.
+	// The sums along these lines are accumulated row by
+	// row.
+	leftDiag := make([]float64, width+1)
+	rightDiag := make([]float64, width+1)
+	nextLeft := make([]float64, width+1)
+	nextRight := make([]float64, width+1)
+	for y := 1; y <= height; y++ {
+		for x := 0; x <= width; x++ {
+			p := pixel(x, y-1)
+			nextLeft[x] = p
+			if x > 0 {
+				nextLeft[x] += leftDiag[x-1]
+			}
+			nextRight[x] = p
+			if x < width {
+				nextRight[x] += rightDiag[x+1]
+			}
+			above := res.integrals[x+(width+1)*(y-1)]
+			res.integrals[x+(width+1)*y] = above + nextLeft[x] + nextRight[x] - p
+		}
+		leftDiag, nextLeft = nextLeft, leftDiag
+		rightDiag, nextRight = nextRight, rightDiag
+	}
+
+	return res
+}
+
+func (t *tiltedTable) at(x, y int) float64 {
+	return t.integrals[x+(t.width+1)*y]
+}
+
+// tiltedRectSum computes the sum of the pixels in a
+// rectangle rotated by 45 degrees.
+//
+// The top pixel of the rectangle is at (x, y).
+// The rectangle extends w pixels down and to the right,
+// and h pixels down and to the left.
+func tiltedRectSum(img TiltedIntegralImage, x, y, w, h int) float64 {
+	return img.TiltedIntegralAt(x-h+w, y+w+h) + img.TiltedIntegralAt(x, y) -
+		(img.TiltedIntegralAt(x-h, y+h) + img.TiltedIntegralAt(x+w, y+w))
+}
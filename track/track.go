@@ -0,0 +1,289 @@
+// Package track follows detected objects across the
+// frames of a video.
+//
+// A Tracker associates the matches from each frame with
+// the tracks from previous frames, so that each object
+// keeps the same ID for as long as it is visible.
+package track
+
+import (
+	"image"
+	"math"
+	"sort"
+
+	"github.com/unixpickle/haar"
+)
+
+// Default options returned by DefaultOptions.
+const (
+	DefaultMinIoU          = 0.3
+	DefaultBirthFrames     = 3
+	DefaultDeathFrames     = 5
+	DefaultSmoothing       = 0.5
+	DefaultMotionSmoothing = 0.5
+)
+
+// Options configures a Tracker.
+//
+// Every field is used as is, so options should start
+// from DefaultOptions rather than the zero value.
+type Options struct {
+	// MinIoU is the minimum intersection over union
+	// between a match and a track's predicted box for the
+	// match to be assigned to the track.
+	// Boxes that do not overlap are never paired, even
+	// when MinIoU is 0.
+	MinIoU float64
+
+	// BirthFrames is the number of consecutive frames in
+	// which a new object must be matched before its track
+	// is confirmed.
+	// Values of 0 and 1 both confirm tracks immediately.
+	BirthFrames int
+
+	// DeathFrames is the number of consecutive frames in
+	// which a confirmed track may go unmatched before it
+	// is removed.
+	// If it is 0, tracks are removed as soon as they are
+	// not matched.
+	DeathFrames int
+
+	// Smoothing is the weight, between 0 and 1, given to
+	// a new match when updating a track's box.
+	// Lower values give smoother but laggier boxes.
+	Smoothing float64
+
+	// MotionSmoothing is the weight, between 0 and 1,
+	// given to the latest movement of a track when
+	// updating its velocity.
+	// If it is 0, tracks never move on their own.
+	MotionSmoothing float64
+}
+
+// DefaultOptions creates options with the default value
+// of every field.
+func DefaultOptions() *Options {
+	return &Options{
+		MinIoU:          DefaultMinIoU,
+		BirthFrames:     DefaultBirthFrames,
+		DeathFrames:     DefaultDeathFrames,
+		Smoothing:       DefaultSmoothing,
+		MotionSmoothing: DefaultMotionSmoothing,
+	}
+}
+
+// A Track is an object followed across frames.
+type Track struct {
+	// ID uniquely identifies the track within a Tracker.
+	// IDs start at 1 and are never reused.
+	ID int
+
+	// X, Y, Width, and Height are the smoothed bounding
+	// box of the object.
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+
+	// VelocityX and VelocityY are the estimated motion of
+	// the box's center, in pixels per frame.
+	VelocityX float64
+	VelocityY float64
+
+	// Match is the match assigned to the track in the
+	// latest frame, or nil if the track was not matched.
+	Match *haar.Match
+
+	// Age is the number of frames since the track was
+	// created, starting at 1.
+	Age int
+
+	// Hits is the number of consecutive frames in which
+	// the track has been matched.
+	Hits int
+
+	// Misses is the number of consecutive frames in which
+	// the track has not been matched.
+	Misses int
+
+	// Confirmed is set once the track has been matched
+	// for BirthFrames consecutive frames.
+	Confirmed bool
+}
+
+// Bounds returns the track's box, rounded to integers.
+func (t *Track) Bounds() image.Rectangle {
+	x, y := int(math.Floor(t.X+0.5)), int(math.Floor(t.Y+0.5))
+	return image.Rect(x, y, x+int(math.Floor(t.Width+0.5)), y+int(math.Floor(t.Height+0.5)))
+}
+
+// predict moves the track by its velocity.
+func (t *Track) predict() {
+	t.X += t.VelocityX
+	t.Y += t.VelocityY
+}
+
+// iou computes the intersection over union of the track's
+// box and a match.
+func (t *Track) iou(m *haar.Match) float64 {
+	minX := math.Max(t.X, float64(m.X))
+	minY := math.Max(t.Y, float64(m.Y))
+	maxX := math.Min(t.X+t.Width, float64(m.X+m.Width))
+	maxY := math.Min(t.Y+t.Height, float64(m.Y+m.Height))
+	if maxX <= minX || maxY <= minY {
+		return 0
+	}
+	intersection := (maxX - minX) * (maxY - minY)
+	union := t.Width*t.Height + float64(m.Width*m.Height) - intersection
+	return intersection / union
+}
+
+// A Tracker assigns persistent tracks to the matches
+// found in consecutive frames.
+type Tracker struct {
+	opts   Options
+	tracks []*Track
+	nextID int
+}
+
+// NewTracker creates a Tracker with the given options.
+//
+// If opts is nil, DefaultOptions is used.
+func NewTracker(opts *Options) *Tracker {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if opts.BirthFrames < 0 || opts.DeathFrames < 0 {
+		panic("frame counts cannot be negative")
+	}
+	if opts.Smoothing < 0 || opts.Smoothing > 1 || opts.MotionSmoothing < 0 ||
+		opts.MotionSmoothing > 1 {
+		panic("smoothing must be between 0 and 1")
+	}
+	return &Tracker{opts: *opts, nextID: 1}
+}
+
+// Update processes the matches from the next frame and
+// returns the confirmed tracks, sorted by ID.
+//
+// Each track's box is first moved by its velocity, and
+// then matches are greedily assigned to the tracks with
+// the highest IoU.
+// Matched tracks move towards their matches, unmatched
+// matches start new tracks, and unmatched tracks keep
+// moving until they die.
+// A track which has not yet been confirmed dies as soon
+// as it is not matched.
+//
+// The matches should already be joined, for example with
+// Matches.JoinOverlaps.
+func (t *Tracker) Update(matches haar.Matches) []*Track {
+	for _, track := range t.tracks {
+		track.predict()
+		track.Age++
+		track.Match = nil
+	}
+
+	type pair struct {
+		track *Track
+		match int
+		iou   float64
+	}
+	var pairs []pair
+	for _, track := range t.tracks {
+		for i, match := range matches {
+			if iou := track.iou(match); iou > 0 && iou >= t.opts.MinIoU {
+				pairs = append(pairs, pair{track, i, iou})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].iou > pairs[j].iou
+	})
+	usedMatches := make([]bool, len(matches))
+	for _, p := range pairs {
+		if p.track.Match == nil && !usedMatches[p.match] {
+			usedMatches[p.match] = true
+			t.observe(p.track, matches[p.match])
+		}
+	}
+
+	var alive []*Track
+	for _, track := range t.tracks {
+		if track.Match == nil {
+			track.Hits = 0
+			track.Misses++
+			if !track.Confirmed || track.Misses > t.opts.DeathFrames {
+				continue
+			}
+		}
+		alive = append(alive, track)
+	}
+	t.tracks = alive
+
+	for i, match := range matches {
+		if !usedMatches[i] {
+			t.tracks = append(t.tracks, t.birth(match))
+		}
+	}
+
+	return t.Tracks()
+}
+
+// Tracks returns the confirmed tracks, sorted by ID.
+func (t *Tracker) Tracks() []*Track {
+	var res []*Track
+	for _, track := range t.tracks {
+		if track.Confirmed {
+			res = append(res, track)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// Reset removes every track.
+// IDs of new tracks continue from where they left off.
+func (t *Tracker) Reset() {
+	t.tracks = nil
+}
+
+func (t *Tracker) observe(track *Track, m *haar.Match) {
+	oldX := track.X + track.Width/2 - track.VelocityX
+	oldY := track.Y + track.Height/2 - track.VelocityY
+
+	s := t.opts.Smoothing
+	track.X += s * (float64(m.X) - track.X)
+	track.Y += s * (float64(m.Y) - track.Y)
+	track.Width += s * (float64(m.Width) - track.Width)
+	track.Height += s * (float64(m.Height) - track.Height)
+
+	ms := t.opts.MotionSmoothing
+	track.VelocityX += ms * (track.X + track.Width/2 - oldX - track.VelocityX)
+	track.VelocityY += ms * (track.Y + track.Height/2 - oldY - track.VelocityY)
+
+	track.Match = m
+	track.Hits++
+	track.Misses = 0
+	if track.Hits >= t.opts.BirthFrames {
+		track.Confirmed = true
+	}
+}
+
+func (t *Tracker) birth(m *haar.Match) *Track {
+	track := &Track{
+		ID:        t.nextID,
+		X:         float64(m.X),
+		Y:         float64(m.Y),
+		Width:     float64(m.Width),
+		Height:    float64(m.Height),
+		Match:     m,
+		Age:       1,
+		Hits:      1,
+		Confirmed: t.opts.BirthFrames <= 1,
+	}
+	t.nextID++
+	return track
+}
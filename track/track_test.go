@@ -0,0 +1,186 @@
+package track
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/haar"
+)
+
+func TestTrackerBirthDeath(t *testing.T) {
+	opts := DefaultOptions()
+	opts.BirthFrames = 2
+	opts.DeathFrames = 2
+	tracker := NewTracker(opts)
+	match := &haar.Match{X: 10, Y: 10, Width: 20, Height: 20}
+
+	if tracks := tracker.Update(haar.Matches{match}); len(tracks) != 0 {
+		t.Fatalf("expected no tracks after one frame but got %d", len(tracks))
+	}
+	tracks := tracker.Update(haar.Matches{match})
+	if len(tracks) != 1 {
+		t.Fatalf("expected one track but got %d", len(tracks))
+	}
+	id := tracks[0].ID
+
+	for i := 0; i < 2; i++ {
+		tracks = tracker.Update(nil)
+		if len(tracks) != 1 || tracks[0].ID != id || tracks[0].Match != nil {
+			t.Fatalf("frame %d: track should survive while missing", i)
+		}
+	}
+	tracks = tracker.Update(haar.Matches{match})
+	if len(tracks) != 1 || tracks[0].ID != id || tracks[0].Match != match {
+		t.Fatal("track should be matched again")
+	}
+
+	for i := 0; i < 3; i++ {
+		tracks = tracker.Update(nil)
+	}
+	if len(tracks) != 0 {
+		t.Fatal("track should have died")
+	}
+}
+
+func TestTrackerTentative(t *testing.T) {
+	tracker := NewTracker(nil)
+	match := &haar.Match{X: 10, Y: 10, Width: 20, Height: 20}
+	tracker.Update(haar.Matches{match})
+	tracker.Update(haar.Matches{match})
+	tracker.Update(nil)
+	tracker.Update(haar.Matches{match})
+	if tracks := tracker.Update(haar.Matches{match}); len(tracks) != 0 {
+		t.Fatal("tentative track should have died after a miss")
+	}
+	if tracks := tracker.Update(haar.Matches{match}); len(tracks) != 1 {
+		t.Fatal("new track should be confirmed")
+	}
+}
+
+func TestTrackerImmediateDeath(t *testing.T) {
+	opts := DefaultOptions()
+	opts.BirthFrames = 1
+	opts.DeathFrames = 0
+	tracker := NewTracker(opts)
+	match := &haar.Match{X: 10, Y: 10, Width: 20, Height: 20}
+	if tracks := tracker.Update(haar.Matches{match}); len(tracks) != 1 {
+		t.Fatalf("expected one track but got %d", len(tracks))
+	}
+	if tracks := tracker.Update(nil); len(tracks) != 0 {
+		t.Fatal("track should have died immediately")
+	}
+}
+
+func TestTrackerZeroIoU(t *testing.T) {
+	opts := DefaultOptions()
+	opts.MinIoU = 0
+	opts.BirthFrames = 1
+	tracker := NewTracker(opts)
+	first := &haar.Match{X: 10, Y: 10, Width: 20, Height: 20}
+	tracks := tracker.Update(haar.Matches{first})
+	if len(tracks) != 1 {
+		t.Fatalf("expected one track but got %d", len(tracks))
+	}
+	id := tracks[0].ID
+
+	far := &haar.Match{X: 100, Y: 100, Width: 20, Height: 20}
+	tracks = tracker.Update(haar.Matches{far})
+	if len(tracks) != 2 {
+		t.Fatalf("expected two tracks but got %d", len(tracks))
+	}
+	for _, track := range tracks {
+		if track.ID == id && track.Match != nil {
+			t.Error("non-overlapping match should not extend a track")
+		} else if track.ID != id && track.Match != far {
+			t.Error("non-overlapping match should start a new track")
+		}
+	}
+}
+
+func TestTrackerIdentity(t *testing.T) {
+	opts := DefaultOptions()
+	opts.BirthFrames = 1
+	tracker := NewTracker(opts)
+	var ids [2]int
+	for frame := 0; frame < 20; frame++ {
+		// The objects move towards each other, so their
+		// order in the matches changes halfway through.
+		left := &haar.Match{X: 10 + frame*3, Y: 50, Width: 20, Height: 20}
+		right := &haar.Match{X: 130 - frame*3, Y: 10, Width: 20, Height: 20}
+		matches := haar.Matches{left, right}
+		if frame >= 10 {
+			matches = haar.Matches{right, left}
+		}
+		tracks := tracker.Update(matches)
+		if len(tracks) != 2 {
+			t.Fatalf("frame %d: expected 2 tracks got %d", frame, len(tracks))
+		}
+		for _, track := range tracks {
+			i := 0
+			if track.Match == right {
+				i = 1
+			}
+			if frame == 0 {
+				ids[i] = track.ID
+			} else if track.ID != ids[i] {
+				t.Fatalf("frame %d: track %d switched objects", frame, track.ID)
+			}
+		}
+	}
+}
+
+func TestTrackerMotion(t *testing.T) {
+	opts := DefaultOptions()
+	opts.BirthFrames = 1
+	opts.Smoothing = 0.5
+	tracker := NewTracker(opts)
+	var tracks []*Track
+	for frame := 0; frame < 30; frame++ {
+		tracks = tracker.Update(haar.Matches{
+			{X: 100 + frame*4, Y: 50, Width: 20, Height: 20},
+		})
+	}
+	track := tracks[0]
+	if math.Abs(track.VelocityX-4) > 1e-3 || math.Abs(track.VelocityY) > 1e-3 {
+		t.Errorf("unexpected velocity %f,%f", track.VelocityX, track.VelocityY)
+	}
+	if math.Abs(track.X-216) > 1e-2 {
+		t.Errorf("expected X near 216 but got %f", track.X)
+	}
+
+	// The track should keep moving while it is missing.
+	tracks = tracker.Update(nil)
+	if math.Abs(tracks[0].X-220) > 1e-2 {
+		t.Errorf("expected predicted X near 220 but got %f", tracks[0].X)
+	}
+
+	// Without motion smoothing, tracks never move on
+	// their own.
+	opts.MotionSmoothing = 0
+	tracker = NewTracker(opts)
+	for frame := 0; frame < 30; frame++ {
+		tracks = tracker.Update(haar.Matches{
+			{X: 100 + frame*4, Y: 50, Width: 20, Height: 20},
+		})
+	}
+	x := tracks[0].X
+	tracks = tracker.Update(nil)
+	if tracks[0].VelocityX != 0 || tracks[0].X != x {
+		t.Errorf("unexpected motion %f to %f", x, tracks[0].X)
+	}
+}
+
+func TestTrackerSmoothing(t *testing.T) {
+	opts := DefaultOptions()
+	opts.BirthFrames = 1
+	opts.Smoothing = 0.25
+	tracker := NewTracker(opts)
+	tracker.Update(haar.Matches{{X: 0, Y: 0, Width: 40, Height: 40}})
+	tracks := tracker.Update(haar.Matches{{X: 8, Y: 0, Width: 40, Height: 40}})
+	if tracks[0].X >= 8 || tracks[0].X <= 0 {
+		t.Errorf("expected smoothed X between 0 and 8 but got %f", tracks[0].X)
+	}
+	if r := tracks[0].Bounds(); r.Dx() != 40 || r.Dy() != 40 {
+		t.Errorf("unexpected bounds %v", r)
+	}
+}
@@ -37,6 +37,39 @@ type Requirements struct {
 	// the layer should be used despite its sub-par
 	// exclusion capability.
 	MaxFeatures int
+
+	// Boosting specifies the kind of weak classifiers
+	// to train.
+	// The zero value is DiscreteAdaBoost.
+	//
+	// Thresholds are meaningless for categorical
+	// features, such as LBPFeature, so if any of the
+	// features are categorical, GentleAdaBoost is used
+	// instead of DiscreteAdaBoost.
+	Boosting BoostingMode
+
+	// Bins is the number of lookup table bins for
+	// RealAdaBoost and GentleAdaBoost.
+	// If it is 0, DefaultLookupBins is used.
+	// It is ignored for categorical features, such as
+	// LBPFeature.
+	Bins int
+
+	// TreeDepth is the depth of the decision trees to
+	// use as weak classifiers.
+	// If it is 0, each weak classifier looks at a single
+	// feature.
+	// The leaves of the trees are trained according to
+	// Boosting, and Bins is ignored.
+	// Like DiscreteAdaBoost, trees are not used if any of
+	// the features are categorical.
+	TreeDepth int
+
+	// Pool, if non-nil, determines the features to use
+	// for this layer.
+	// It takes precedence over the features passed to
+	// TrainFeatures or TrainMoreFeatures.
+	Pool *FeaturePool
 }
 
 // Train trains a cascade classifier given the
@@ -63,6 +96,33 @@ func Train(layerReqs []*Requirements, s SampleSource, l Logger) *Cascade {
 // layers to add, not the total number of layers in
 // the final cascade.
 func TrainMore(c *Cascade, addReqs []*Requirements, s SampleSource, l Logger) {
+	TrainMoreFeatures(c, addReqs, s, nil, l)
+}
+
+// TrainFeatures is like Train, but it chooses from the
+// given features instead of every Haar-like feature.
+//
+// If features is nil, AllFeatures is used.
+func TrainFeatures(layerReqs []*Requirements, s SampleSource, features []WindowFeature,
+	l Logger) *Cascade {
+	var res Cascade
+
+	TrainMoreFeatures(&res, layerReqs, s, features, l)
+
+	return &res
+}
+
+// TrainMoreFeatures is like TrainMore, but it chooses
+// from the given features instead of every Haar-like
+// feature.
+//
+// If features is nil, AllFeatures is used.
+//
+// Training stops early if a layer has no features to
+// choose from, for example if its Requirements.Pool
+// fails FeaturePool.Validate for the window size.
+func TrainMoreFeatures(c *Cascade, addReqs []*Requirements, s SampleSource,
+	features []WindowFeature, l Logger) {
 	positives := s.Positives()
 	if len(c.Layers) > 0 {
 		positives = acceptedPositives(positives, c)
@@ -74,7 +134,7 @@ func TrainMore(c *Cascade, addReqs []*Requirements, s SampleSource, l Logger) {
 	c.WindowWidth = positives[0].Width()
 	c.WindowHeight = positives[0].Height()
 
-	features := AllFeatures(positives[0].Width(), positives[0].Height())
+	poolFeatures := map[*FeaturePool][]WindowFeature{}
 
 	for _, reqs := range addReqs {
 		if l != nil {
@@ -92,14 +152,42 @@ func TrainMore(c *Cascade, addReqs []*Requirements, s SampleSource, l Logger) {
 		if len(negs) == 0 {
 			break
 		}
-		layer := trainLayer(reqs, positives, negs, features, l)
+		var layerFeatures []WindowFeature
+		if reqs.Pool != nil {
+			if _, ok := poolFeatures[reqs.Pool]; !ok {
+				poolFeatures[reqs.Pool] = reqs.Pool.Features(c.WindowWidth, c.WindowHeight)
+			}
+			layerFeatures = poolFeatures[reqs.Pool]
+		} else {
+			if features == nil {
+				features = windowFeatures(AllFeatures(c.WindowWidth, c.WindowHeight))
+			}
+			layerFeatures = features
+		}
+		if len(layerFeatures) == 0 {
+			break
+		}
+		layer := trainLayer(reqs, positives, negs, layerFeatures, l)
 		c.Layers = append(c.Layers, layer)
 		positives = acceptedPositives(positives, layer)
 	}
 }
 
-func trainLayer(reqs *Requirements, pos, neg []IntegralImage, features []*Feature,
+func trainLayer(reqs *Requirements, pos, neg []IntegralImage, features []WindowFeature,
 	l Logger) *Layer {
+	if (reqs.Boosting == DiscreteAdaBoost || reqs.TreeDepth > 0) &&
+		hasCategorical(features) {
+		tableReqs := *reqs
+		if tableReqs.Boosting == DiscreteAdaBoost {
+			tableReqs.Boosting = GentleAdaBoost
+		}
+		tableReqs.TreeDepth = 0
+		reqs = &tableReqs
+	}
+	if reqs.Boosting != DiscreteAdaBoost || reqs.TreeDepth > 0 {
+		return trainWeightedLayer(reqs, pos, neg, features, l)
+	}
+
 	allSamples := make([]IntegralImage, len(pos)+len(neg))
 	copy(allSamples, pos)
 	copy(allSamples[len(pos):], neg)
@@ -125,15 +213,8 @@ func trainLayer(reqs *Requirements, pos, neg []IntegralImage, features []*Featur
 		gradient.Step()
 		threshold = necessaryThreshold(gradient.OutCache, desired, reqs.PositiveRetention)
 		ret, exc := boostingScores(gradient.OutCache, desired, threshold)
-		if l != nil {
-			latestFeature := gradient.Sum.Classifiers[i].(*boostingClassifier).Feature
-			if exc > 0 {
-				l.LogFeature(i+1, ret, exc, latestFeature)
-			} else {
-				rawRet, rawExc := boostingScores(gradient.OutCache, desired, 0)
-				l.LogFeature(i+1, rawRet, rawExc, latestFeature)
-			}
-		}
+		latestFeature := gradient.Sum.Classifiers[i].(*boostingClassifier).Feature
+		logLayerFeature(l, i+1, latestFeature, gradient.OutCache, desired, ret, exc)
 		if ret >= reqs.PositiveRetention && exc >= reqs.NegativeExclusion {
 			break
 		}
@@ -152,6 +233,15 @@ func trainLayer(reqs *Requirements, pos, neg []IntegralImage, features []*Featur
 	return layer
 }
 
+func hasCategorical(features []WindowFeature) bool {
+	for _, f := range features {
+		if _, ok := f.(CategoricalFeature); ok {
+			return true
+		}
+	}
+	return false
+}
+
 type boostingSamples []IntegralImage
 
 func (b boostingSamples) Len() int {
@@ -159,7 +249,7 @@ func (b boostingSamples) Len() int {
 }
 
 type boostingClassifier struct {
-	Feature   *Feature
+	Feature   WindowFeature
 	Threshold float64
 }
 
@@ -182,11 +272,11 @@ type boostingOption struct {
 }
 
 type boostingPool struct {
-	Features []*Feature
+	Features []WindowFeature
 }
 
 func (b *boostingPool) BestClassifier(s boosting.SampleList, w linalg.Vector) boosting.Classifier {
-	featureChan := make(chan *Feature, len(b.Features))
+	featureChan := make(chan WindowFeature, len(b.Features))
 	for _, f := range b.Features {
 		featureChan <- f
 	}
@@ -220,7 +310,7 @@ func (b *boostingPool) BestClassifier(s boosting.SampleList, w linalg.Vector) bo
 	return bestOption.Classifier
 }
 
-func bestFeatureSplit(feature *Feature, s boostingSamples, w linalg.Vector) boostingOption {
+func bestFeatureSplit(feature WindowFeature, s boostingSamples, w linalg.Vector) boostingOption {
 	var bestOption boostingOption
 
 	weightSumsForOutputs := map[float64]float64{}
@@ -3,6 +3,7 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -10,35 +11,100 @@ import (
 	"strconv"
 
 	"github.com/unixpickle/haar"
+	"github.com/unixpickle/haar/dataset"
 )
 
 const defaultInitialRetention = 0.99
 
 func main() {
-	if len(os.Args) != 4 && len(os.Args) != 5 {
-		fmt.Fprintf(os.Stderr, "Usage: %s pos_dir neg_dir output_file [initial_retention]\n",
-			os.Args[0])
+	var pool haar.FeaturePool
+	var types string
+	flag.StringVar(&types, "types", "", "comma-separated feature types (default the five basic types)")
+	flag.IntVar(&pool.MinWidth, "min-width", 0, "minimum feature width")
+	flag.IntVar(&pool.MinHeight, "min-height", 0, "minimum feature height")
+	flag.IntVar(&pool.PositionStep, "position-step", 1, "step between feature positions")
+	flag.IntVar(&pool.SizeStep, "size-step", 1, "step between feature part sizes")
+	flag.IntVar(&pool.MaxCount, "pool-size", 0, "maximum number of features (0 for no limit)")
+	flag.Int64Var(&pool.Seed, "seed", 0, "seed for choosing features")
+	mirror := flag.Bool("mirror", false, "add mirrored copies of the positive samples")
+	format := flag.String("format", "",
+		"load positives from annotations in this format (json, voc, coco, or infodat)")
+	imageDir := flag.String("images", "", "image directory for VOC or COCO annotations")
+	label := flag.String("label", "", "only train on annotated boxes with this label")
+	width := flag.Int("width", 24, "window width for annotated positives")
+	height := flag.Int("height", 24, "window height for annotated positives")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] pos_dir neg_dir output_file"+
+			" [initial_retention [haar|lbp]]\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "With -format, pos_dir is the annotations, and annotated images")
+		fmt.Fprintln(os.Stderr, "without matching boxes are added to the negatives.")
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 3 || len(args) > 5 {
+		flag.Usage()
 		os.Exit(1)
 	}
 
 	initialRetention := defaultInitialRetention
-	if len(os.Args) == 5 {
+	if len(args) >= 4 {
 		var err error
-		initialRetention, err = strconv.ParseFloat(os.Args[4], 64)
+		initialRetention, err = strconv.ParseFloat(args[3], 64)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Invalid initial retention:", os.Args[4])
+			fmt.Fprintln(os.Stderr, "Invalid initial retention:", args[3])
 			os.Exit(1)
 		}
 	}
 
+	if len(args) == 5 {
+		family := args[4]
+		if family != "haar" && family != "lbp" {
+			fmt.Fprintln(os.Stderr, "Invalid feature family:", family)
+			os.Exit(1)
+		}
+		pool.LBP = family == "lbp"
+	}
+
+	var err error
+	pool.Types, err = haar.ParseFeatureTypes(types)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	log.Println("Loading samples ...")
 
-	posDir, negDir := os.Args[1], os.Args[2]
-	samples, err := haar.LoadSampleSource(posDir, negDir)
+	posDir, negDir := args[0], args[1]
+	var samples haar.SampleSource
+	if *format != "" {
+		var annotations []*dataset.Annotation
+		annotations, err = dataset.Load(*format, posDir, *imageDir)
+		if err == nil {
+			samples, err = dataset.SampleSource(annotations, *label, *width, *height, negDir)
+		}
+	} else {
+		samples, err = haar.LoadSampleSource(posDir, negDir)
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Failed to load samples:", err)
 		os.Exit(1)
 	}
+	if *mirror {
+		samples = haar.MirrorPositives(samples)
+	}
+
+	windowWidth, windowHeight := *width, *height
+	if *format == "" {
+		pos := samples.Positives()[0]
+		windowWidth, windowHeight = pos.Width(), pos.Height()
+	}
+	if err := pool.Validate(windowWidth, windowHeight); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid feature pool:", err)
+		os.Exit(1)
+	}
 
 	var reqs []*haar.Requirements
 	for i := 0; i < 4; i++ {
@@ -56,6 +122,9 @@ func main() {
 		})
 	}
 	reqs[0].PositiveRetention = initialRetention
+	for _, r := range reqs {
+		r.Pool = &pool
+	}
 
 	cascade := haar.Train(reqs, samples, haar.ConsoleLogger{})
 
@@ -64,7 +133,7 @@ func main() {
 		fmt.Fprintln(os.Stderr, "Failed to marshal data:", err)
 		os.Exit(1)
 	}
-	if err := ioutil.WriteFile(os.Args[3], data, 0755); err != nil {
+	if err := ioutil.WriteFile(args[2], data, 0755); err != nil {
 		fmt.Fprintln(os.Stderr, "Failed to write file:", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,201 @@
+package haar
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+// A DecisionTree is a weak classifier which chooses an
+// output by comparing features to thresholds.
+//
+// A node with a nil Feature is a leaf.
+// Otherwise, the node continues to High if the feature's
+// value is greater than Threshold, or to Low if not.
+type DecisionTree struct {
+	Feature   WindowFeature `json:",omitempty"`
+	Threshold float64       `json:",omitempty"`
+	Low       *DecisionTree `json:",omitempty"`
+	High      *DecisionTree `json:",omitempty"`
+
+	// Output is the output of a leaf node.
+	Output float64 `json:",omitempty"`
+}
+
+// Classify returns the output of the leaf which the
+// image window reaches.
+func (d *DecisionTree) Classify(img IntegralImage) float64 {
+	node := d
+	for node.Feature != nil {
+		if node.Feature.Value(img) > node.Threshold {
+			node = node.High
+		} else {
+			node = node.Low
+		}
+	}
+	return node.Output
+}
+
+// Depth returns the number of branch nodes on the
+// longest path from the root to a leaf.
+func (d *DecisionTree) Depth() int {
+	if d.Feature == nil {
+		return 0
+	}
+	low, high := d.Low.Depth(), d.High.Depth()
+	if low > high {
+		return low + 1
+	}
+	return high + 1
+}
+
+// maxOutput returns the maximum absolute value of any
+// leaf's output.
+func (d *DecisionTree) maxOutput() float64 {
+	if d.Feature == nil {
+		return math.Abs(d.Output)
+	}
+	return math.Max(d.Low.maxOutput(), d.High.maxOutput())
+}
+
+// scaled creates a version of the tree for windows which
+// are scaled by the given factors.
+func (d *DecisionTree) scaled(xScale, yScale float64, width, height int) *DecisionTree {
+	if d.Feature == nil {
+		return &DecisionTree{Output: d.Output}
+	}
+	feature, areaScale := scaleFeature(d.Feature, xScale, yScale, width, height)
+	return &DecisionTree{
+		Feature:   feature,
+		Threshold: d.Threshold / areaScale,
+		Low:       d.Low.scaled(xScale, yScale, width, height),
+		High:      d.High.scaled(xScale, yScale, width, height),
+	}
+}
+
+// MarshalJSON encodes the tree, including the kinds of
+// its features.
+func (d *DecisionTree) MarshalJSON() ([]byte, error) {
+	type tree DecisionTree
+	obj := struct {
+		Feature *featureJSON `json:",omitempty"`
+		*tree
+	}{tree: (*tree)(d)}
+	if d.Feature != nil {
+		obj.Feature = &featureJSON{Feature: d.Feature}
+	}
+	return json.Marshal(&obj)
+}
+
+// UnmarshalJSON decodes a tree encoded by MarshalJSON.
+func (d *DecisionTree) UnmarshalJSON(data []byte) error {
+	type tree DecisionTree
+	obj := struct {
+		Feature *featureJSON
+		*tree
+	}{tree: (*tree)(d)}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	d.Feature = nil
+	if obj.Feature != nil {
+		d.Feature = obj.Feature.Feature
+	}
+	return nil
+}
+
+// trainTree greedily trains a tree on the samples with
+// the given indices.
+func trainTree(mode BoostingMode, features []WindowFeature, s []IntegralImage,
+	desired linalg.Vector, w []float64, indices []int, depth int,
+	epsilon float64) *DecisionTree {
+	var posWeight, negWeight float64
+	for _, i := range indices {
+		if desired[i] > 0 {
+			posWeight += w[i]
+		} else {
+			negWeight += w[i]
+		}
+	}
+	leaf := &DecisionTree{Output: mode.leafOutput(posWeight, negWeight, epsilon)}
+	if depth == 0 {
+		return leaf
+	}
+
+	idx := bestFeature(len(features), func(i int) float64 {
+		_, loss := bestTreeSplit(mode, features[i], s, desired, w, indices, epsilon)
+		return loss
+	})
+	threshold, loss := bestTreeSplit(mode, features[idx], s, desired, w, indices, epsilon)
+	if math.IsInf(loss, 1) {
+		return leaf
+	}
+
+	var low, high []int
+	for _, i := range indices {
+		if features[idx].Value(s[i]) > threshold {
+			high = append(high, i)
+		} else {
+			low = append(low, i)
+		}
+	}
+	return &DecisionTree{
+		Feature:   features[idx],
+		Threshold: threshold,
+		Low:       trainTree(mode, features, s, desired, w, low, depth-1, epsilon),
+		High:      trainTree(mode, features, s, desired, w, high, depth-1, epsilon),
+	}
+}
+
+// bestTreeSplit finds the threshold for a feature which
+// minimizes the loss of splitting the samples with the
+// given indices into two leaves.
+//
+// If the feature has the same value for every sample,
+// the loss is infinite.
+func bestTreeSplit(mode BoostingMode, feature WindowFeature, s []IntegralImage,
+	desired linalg.Vector, w []float64, indices []int,
+	epsilon float64) (threshold, loss float64) {
+	values := make([]float64, len(indices))
+	sorted := make([]int, len(indices))
+	var highPos, highNeg float64
+	for i, idx := range indices {
+		values[i] = feature.Value(s[idx])
+		sorted[i] = i
+		if desired[idx] > 0 {
+			highPos += w[idx]
+		} else {
+			highNeg += w[idx]
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return values[sorted[i]] < values[sorted[j]]
+	})
+
+	loss = math.Inf(1)
+	var lowPos, lowNeg float64
+	for i := 0; i+1 < len(sorted); i++ {
+		j := sorted[i]
+		idx := indices[j]
+		if desired[idx] > 0 {
+			lowPos += w[idx]
+			highPos -= w[idx]
+		} else {
+			lowNeg += w[idx]
+			highNeg -= w[idx]
+		}
+		value, next := values[j], values[sorted[i+1]]
+		if value == next {
+			continue
+		}
+		splitLoss := mode.leafLoss(lowPos, lowNeg, epsilon) +
+			mode.leafLoss(highPos, highNeg, epsilon)
+		if splitLoss < loss {
+			loss = splitLoss
+			threshold = (value + next) / 2
+		}
+	}
+	return
+}
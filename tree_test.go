@@ -0,0 +1,208 @@
+package haar
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDecisionTreeClassify(t *testing.T) {
+	img := NewDualImage(scanTestImage(8, 8, 5)).Window(0, 0, 8, 8)
+	f1 := &Feature{HorizontalPair, 0, 0, 8, 8}
+	f2 := &Feature{VerticalPair, 0, 0, 8, 8}
+	v1, v2 := f1.Value(img), f2.Value(img)
+
+	tree := &DecisionTree{
+		Feature:   f1,
+		Threshold: v1 - 1,
+		Low:       &DecisionTree{Output: -3},
+		High: &DecisionTree{
+			Feature:   f2,
+			Threshold: v2 + 1,
+			Low:       &DecisionTree{Output: 2},
+			High:      &DecisionTree{Output: 5},
+		},
+	}
+	if out := tree.Classify(img); out != 2 {
+		t.Errorf("expected output 2 got %f", out)
+	}
+	if depth := tree.Depth(); depth != 2 {
+		t.Errorf("expected depth 2 got %d", depth)
+	}
+	if max := tree.maxOutput(); max != 5 {
+		t.Errorf("expected max output 5 got %f", max)
+	}
+}
+
+func TestTrainTreeLayer(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	var pos, neg []IntegralImage
+	for i := 0; i < 60; i++ {
+		pos = append(pos, treeTestSample(gen, true, true))
+		neg = append(neg, treeTestSample(gen, gen.Intn(2) == 0, false))
+		neg = append(neg, treeTestSample(gen, false, true))
+	}
+	features := windowFeatures(AllFeatures(6, 6))
+
+	for _, mode := range []BoostingMode{DiscreteAdaBoost, RealAdaBoost, GentleAdaBoost} {
+		reqs := &Requirements{
+			PositiveRetention: 0.95,
+			NegativeExclusion: 0.9,
+			MaxFeatures:       5,
+			Boosting:          mode,
+			TreeDepth:         2,
+		}
+		layer := trainLayer(reqs, pos, neg, features, nil)
+		if len(layer.Trees) != len(layer.Features) {
+			t.Errorf("mode %d: expected %d trees got %d", mode, len(layer.Features),
+				len(layer.Trees))
+			continue
+		}
+		for i, tree := range layer.Trees {
+			if tree.Feature != layer.Features[i] || tree.Threshold != layer.Thresholds[i] {
+				t.Errorf("mode %d: tree %d root does not match feature", mode, i)
+			}
+			if tree.Depth() > reqs.TreeDepth {
+				t.Errorf("mode %d: tree %d has depth %d", mode, i, tree.Depth())
+			}
+		}
+
+		var retained, excluded int
+		for _, x := range pos {
+			if layer.Classify(x) {
+				retained++
+			}
+		}
+		for _, x := range neg {
+			if !layer.Classify(x) {
+				excluded++
+			}
+		}
+		if ret := float64(retained) / float64(len(pos)); ret < reqs.PositiveRetention {
+			t.Errorf("mode %d: bad retention %f", mode, ret)
+		}
+		if exc := float64(excluded) / float64(len(neg)); exc < reqs.NegativeExclusion {
+			t.Errorf("mode %d: bad exclusion %f", mode, exc)
+		}
+
+		data, err := json.Marshal(layer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Layer
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		for i, x := range append(pos[:10:10], neg[:10]...) {
+			if decoded.Sum(x) != layer.Sum(x) {
+				t.Errorf("mode %d sample %d: decoded sum %f but expected %f", mode, i,
+					decoded.Sum(x), layer.Sum(x))
+			}
+		}
+	}
+}
+
+func TestTreeCascadeScan(t *testing.T) {
+	cascade := treeTestCascade()
+	compiled := cascade.Compile()
+	soft := NewSoftCascade(cascade)
+	img := NewDualImage(scanTestImage(70, 50, 3))
+	opts := &ScanOptions{Scale: 1.1, StrideX: 1.5}
+
+	expected, _ := cascade.ScanWithOptions(context.Background(), img, opts)
+	if len(expected) == 0 {
+		t.Fatal("expected some matches")
+	}
+	softMatches, _ := soft.ScanWithOptions(context.Background(), img, opts)
+	if !scanTestMatchesEqual(expected, softMatches) {
+		t.Error("soft cascade gave different matches")
+	}
+	compiledMatches, _ := compiled.ScanWithOptions(context.Background(), img, opts)
+	if len(compiledMatches) != len(expected) {
+		t.Fatalf("expected %d compiled matches got %d", len(expected), len(compiledMatches))
+	}
+	for i, x := range expected {
+		a := compiledMatches[i]
+		if x.X != a.X || x.Y != a.Y || x.Width != a.Width || math.Abs(x.Score-a.Score) > 1e-8 {
+			t.Errorf("match %d: expected %v got %v", i, x, a)
+		}
+	}
+}
+
+// treeTestSample creates a 6x6 training sample which
+// may have a bright left half and a bright top half.
+func TestTrainTreeLayerInseparable(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	sample := treeTestSample(gen, true, true)
+	var pos, neg []IntegralImage
+	for i := 0; i < 10; i++ {
+		pos = append(pos, sample)
+		neg = append(neg, sample, sample)
+	}
+	features := windowFeatures(AllFeatures(6, 6))
+
+	for _, mode := range []BoostingMode{DiscreteAdaBoost, RealAdaBoost, GentleAdaBoost} {
+		reqs := &Requirements{
+			PositiveRetention: 0.95,
+			NegativeExclusion: 0.9,
+			MaxFeatures:       5,
+			Boosting:          mode,
+			TreeDepth:         2,
+		}
+		layer := trainLayer(reqs, pos, neg, features, nil)
+		if len(layer.Features) != 1 || len(layer.Tables) != 1 || len(layer.Trees) != 1 {
+			t.Errorf("mode %d: expected one lookup table but got %d features, %d tables",
+				mode, len(layer.Features), len(layer.Tables))
+			continue
+		}
+		if layer.Trees[0] != nil {
+			t.Errorf("mode %d: unexpected tree", mode)
+		}
+		for _, x := range pos {
+			if !layer.Classify(x) {
+				t.Errorf("mode %d: positive was not retained", mode)
+				break
+			}
+		}
+	}
+}
+
+func treeTestSample(gen *rand.Rand, left, top bool) IntegralImage {
+	pixels := make([]float64, 6*6)
+	for i := range pixels {
+		pixels[i] = gen.Float64() * 0.5
+		if left && i%6 < 3 {
+			pixels[i] += 0.25
+		}
+		if top && i/6 < 3 {
+			pixels[i] += 0.25
+		}
+	}
+	return NewDualImage(BitmapIntegralImage(pixels, 6, 6)).Window(0, 0, 6, 6)
+}
+
+// treeTestCascade creates a version of scanTestCascade
+// with a decision tree in its second layer.
+func treeTestCascade() *Cascade {
+	cascade := scanTestCascade()
+	layer := cascade.Layers[1]
+	root := layer.Features[1]
+	layer.Trees = []*DecisionTree{
+		nil,
+		{
+			Feature:   root,
+			Threshold: layer.Thresholds[1],
+			Low: &DecisionTree{
+				Feature:   &Feature{VerticalPair, 2, 0, 4, 8},
+				Threshold: 0.5,
+				Low:       &DecisionTree{Output: -1},
+				High:      &DecisionTree{Output: 0.5},
+			},
+			High: &DecisionTree{Output: 1},
+		},
+		nil,
+	}
+	return cascade
+}
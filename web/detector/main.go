@@ -5,11 +5,13 @@ import (
 
 	"github.com/gopherjs/gopherjs/js"
 	"github.com/unixpickle/haar"
+	"github.com/unixpickle/haar/track"
 )
 
 const overlapThreshold = 0.3
 
 var cascade *haar.Cascade
+var tracker = track.NewTracker(nil)
 
 func main() {
 	js.Global.Set("onmessage", js.MakeFunc(messageHandler))
@@ -41,10 +43,15 @@ func recognize(width, height int, buffer *js.Object) interface{} {
 	for i := range bitmap {
 		bitmap[i] = buffer.Index(i).Float()
 	}
-	img := haar.BitmapIntegralImage(bitmap, width, height)
-	dualImg := haar.NewDualImage(img)
+	dualImg := haar.BitmapDualImage(bitmap, width, height, haar.Float32Integrals)
 
 	matches := cascade.Scan(dualImg, 0, 1.5).JoinOverlaps(overlapThreshold)
-	data, _ := json.Marshal(matches)
+	data, err := json.Marshal(map[string]interface{}{
+		"Matches": matches,
+		"Tracks":  tracker.Update(matches),
+	})
+	if err != nil {
+		panic(err)
+	}
 	return js.Global.Get("JSON").Call("parse", string(data))
 }
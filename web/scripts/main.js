@@ -4,7 +4,7 @@
 
   var camera = null;
   var canvas = null;
-  var currentMatches = null;
+  var currentTracks = null;
 
   function initialize() {
     canvas = document.getElementById('video-cell');
@@ -22,11 +22,14 @@
         ctx.clearRect(0, 0, canvas.width, canvas.height);
         ctx.drawImage(frame, 0, 0);
 
-        if (currentMatches !== null) {
+        if (currentTracks !== null) {
           ctx.strokeStyle = '#ff0000';
-          for (var i = 0, len = currentMatches.length; i < len; ++i) {
-            var match = currentMatches[i];
-            ctx.strokeRect(match.X, match.Y, match.Width, match.Height);
+          ctx.fillStyle = '#ff0000';
+          ctx.font = '14px sans-serif';
+          for (var i = 0, len = currentTracks.length; i < len; ++i) {
+            var track = currentTracks[i];
+            ctx.strokeRect(track.X, track.Y, track.Width, track.Height);
+            ctx.fillText('#' + track.ID, track.X, track.Y - 4);
           }
         }
 
@@ -34,9 +37,9 @@
           return;
         }
         recognizing = true;
-        var matches = detectFacesInCanvas(frame, function(matches) {
+        detectFacesInCanvas(frame, function(result) {
           recognizing = false;
-          currentMatches = matches;
+          currentTracks = result.Tracks;
         });
       }, 100);
     };
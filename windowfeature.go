@@ -0,0 +1,180 @@
+package haar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// HaarFeatureKind is the kind of the built-in Feature.
+const HaarFeatureKind = "haar"
+
+// A WindowFeature computes a value from an image window.
+//
+// Feature is the built-in WindowFeature.
+// Other implementations can be used by layers, decision
+// trees, and the trainer.
+// To be encoded and decoded as JSON, an implementation
+// must be registered with RegisterFeature.
+type WindowFeature interface {
+	// Value evaluates the feature on the given window.
+	Value(img IntegralImage) float64
+
+	// Kind returns the name under which the feature's type
+	// is registered.
+	Kind() string
+}
+
+// A ScalableFeature is a WindowFeature which can create
+// a version of itself for windows of a different size.
+//
+// Features which do not implement ScalableFeature are
+// scaled by evaluating them on a ScaleIntegralImage of
+// each scaled window.
+type ScalableFeature interface {
+	WindowFeature
+
+	// ScaledFeature is like Feature.Scaled.
+	ScaledFeature(xScale, yScale float64, windowWidth,
+		windowHeight int) (feature WindowFeature, areaScale float64)
+}
+
+var featureKinds = map[string]func() WindowFeature{}
+var featureKindsLock sync.RWMutex
+
+func init() {
+	RegisterFeature(HaarFeatureKind, func() WindowFeature {
+		return &Feature{}
+	})
+}
+
+// RegisterFeature registers a kind of WindowFeature so
+// that it can be decoded from JSON.
+//
+// The constructor should return a new feature which the
+// JSON data can be unmarshaled into.
+// Features of the kind are encoded with json.Marshal.
+//
+// This panics if the kind is already registered.
+func RegisterFeature(kind string, constructor func() WindowFeature) {
+	featureKindsLock.Lock()
+	defer featureKindsLock.Unlock()
+	if _, ok := featureKinds[kind]; ok {
+		panic("feature kind already registered: " + kind)
+	}
+	featureKinds[kind] = constructor
+}
+
+// featureJSON encodes a WindowFeature along with its kind.
+//
+// Built-in features are encoded without a kind, so that
+// they have the same format as before other kinds of
+// features were supported.
+type featureJSON struct {
+	Feature WindowFeature
+}
+
+func (f *featureJSON) MarshalJSON() ([]byte, error) {
+	if haarFeature, ok := f.Feature.(*Feature); ok {
+		return json.Marshal(haarFeature)
+	}
+	data, err := json.Marshal(f.Feature)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&struct {
+		Kind string
+		Data json.RawMessage
+	}{f.Feature.Kind(), data})
+}
+
+func (f *featureJSON) UnmarshalJSON(data []byte) error {
+	var header struct {
+		Kind string
+		Data json.RawMessage
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	if header.Kind == "" {
+		var haarFeature Feature
+		if err := json.Unmarshal(data, &haarFeature); err != nil {
+			return err
+		}
+		f.Feature = &haarFeature
+		return nil
+	}
+
+	featureKindsLock.RLock()
+	constructor, ok := featureKinds[header.Kind]
+	featureKindsLock.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown feature kind: %s", header.Kind)
+	}
+	f.Feature = constructor()
+	return json.Unmarshal(header.Data, f.Feature)
+}
+
+func encodeFeatures(features []WindowFeature) []*featureJSON {
+	res := make([]*featureJSON, len(features))
+	for i, f := range features {
+		res[i] = &featureJSON{Feature: f}
+	}
+	return res
+}
+
+func decodeFeatures(features []*featureJSON) []WindowFeature {
+	if features == nil {
+		return nil
+	}
+	res := make([]WindowFeature, len(features))
+	for i, f := range features {
+		if f != nil {
+			res[i] = f.Feature
+		}
+	}
+	return res
+}
+
+// windowFeatures converts built-in features to a list of
+// WindowFeatures.
+func windowFeatures(features []*Feature) []WindowFeature {
+	res := make([]WindowFeature, len(features))
+	for i, f := range features {
+		res[i] = f
+	}
+	return res
+}
+
+// scaleFeature scales a feature like Feature.Scaled.
+func scaleFeature(f WindowFeature, xScale, yScale float64, windowWidth,
+	windowHeight int) (WindowFeature, float64) {
+	if scalable, ok := f.(ScalableFeature); ok {
+		return scalable.ScaledFeature(xScale, yScale, windowWidth, windowHeight)
+	}
+	return &windowScaledFeature{Feature: f, XScale: xScale, YScale: yScale}, 1
+}
+
+// A windowScaledFeature evaluates a feature on scaled
+// windows by scaling each window back to the size the
+// feature was designed for.
+type windowScaledFeature struct {
+	Feature WindowFeature
+	XScale  float64
+	YScale  float64
+}
+
+func (w *windowScaledFeature) Value(img IntegralImage) float64 {
+	width := int(float64(img.Width())/w.XScale + 0.5)
+	height := int(float64(img.Height())/w.YScale + 0.5)
+	return w.Feature.Value(ScaleIntegralImage(img, width, height))
+}
+
+func (w *windowScaledFeature) Kind() string {
+	return w.Feature.Kind()
+}
+
+func (w *windowScaledFeature) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("cannot encode scaled feature of kind " + w.Kind())
+}
@@ -0,0 +1,191 @@
+package haar
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func init() {
+	RegisterFeature("test-template", func() WindowFeature {
+		return &templateTestFeature{}
+	})
+}
+
+func TestWindowFeatureJSON(t *testing.T) {
+	cascade := templateTestCascade()
+	data, err := json.Marshal(cascade)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Cascade
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := decoded.Layers[0].Features[0].(*Feature); !ok {
+		t.Error("expected built-in feature")
+	}
+	if _, ok := decoded.Layers[1].Trees[2].Feature.(*templateTestFeature); !ok {
+		t.Error("expected template feature in tree")
+	}
+	img := NewDualImage(scanTestImage(30, 20, 3))
+	for y := 0; y+8 <= img.Height(); y++ {
+		for x := 0; x+8 <= img.Width(); x++ {
+			window := img.Window(x, y, 8, 8)
+			expected, _ := cascade.Sums(window)
+			actual, _ := decoded.Sums(window)
+			if !floatSlicesEqual(expected, actual) {
+				t.Fatalf("window %d,%d: expected sums %v got %v", x, y, expected, actual)
+			}
+		}
+	}
+
+	var unknown Layer
+	err = json.Unmarshal([]byte(`{"Features":[{"Kind":"nonexistent","Data":{}}]}`), &unknown)
+	if err == nil {
+		t.Error("expected error for unknown kind")
+	}
+}
+
+func TestWindowFeatureLegacyJSON(t *testing.T) {
+	data := `{"Features":[{"Type":1,"X":2,"Y":3,"Width":4,"Height":6}],` +
+		`"Thresholds":[0.5],"Weights":[1],"Threshold":0}`
+	var layer Layer
+	if err := json.Unmarshal([]byte(data), &layer); err != nil {
+		t.Fatal(err)
+	}
+	expected := Feature{Type: VerticalPair, X: 2, Y: 3, Width: 4, Height: 6}
+	if f, ok := layer.Features[0].(*Feature); !ok || *f != expected {
+		t.Fatalf("unexpected feature: %v", layer.Features[0])
+	}
+	encoded, err := json.Marshal(&layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != data {
+		t.Errorf("unexpected encoding: %s", encoded)
+	}
+}
+
+func TestWindowFeatureScan(t *testing.T) {
+	cascade := templateTestCascade()
+	img := NewDualImage(scanTestImage(70, 50, 5))
+	opts := &ScanOptions{Scale: 1.1, StrideX: 1.5}
+	expected, _ := cascade.ScanWithOptions(context.Background(), img, opts)
+	if len(expected) == 0 {
+		t.Fatal("expected some matches")
+	}
+
+	compiled, _ := cascade.Compile().ScanWithOptions(context.Background(), img, opts)
+	if len(compiled) != len(expected) {
+		t.Fatalf("expected %d compiled matches got %d", len(expected), len(compiled))
+	}
+	for i, x := range expected {
+		a := compiled[i]
+		if x.X != a.X || x.Y != a.Y || x.Width != a.Width || math.Abs(x.Score-a.Score) > 1e-8 {
+			t.Errorf("match %d: expected %v got %v", i, x, a)
+		}
+	}
+
+	featureOpts := *opts
+	featureOpts.Mode = ScaleFeatures
+	scaled, err := cascade.ScanWithOptions(context.Background(), img, &featureOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scaled) == 0 {
+		t.Error("expected some matches when scaling features")
+	}
+}
+
+func TestTrainWindowFeatures(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	var pos, neg []IntegralImage
+	for i := 0; i < 60; i++ {
+		pos = append(pos, boostTestSample(gen, true))
+		neg = append(neg, boostTestSample(gen, false))
+	}
+	var features []WindowFeature
+	for x := 0; x < 6; x++ {
+		features = append(features, &templateTestFeature{X: x, Width: 1, Height: 6})
+	}
+	for _, reqs := range []*Requirements{
+		{PositiveRetention: 0.95, NegativeExclusion: 0.9, MaxFeatures: 10,
+			Boosting: RealAdaBoost},
+		{PositiveRetention: 0.95, NegativeExclusion: 0.9, MaxFeatures: 10,
+			TreeDepth: 2},
+	} {
+		layer := trainLayer(reqs, pos, neg, features, nil)
+		for _, f := range layer.Features {
+			if _, ok := f.(*templateTestFeature); !ok {
+				t.Fatalf("mode %d: unexpected feature %v", reqs.Boosting, f)
+			}
+		}
+		var excluded int
+		for _, x := range neg {
+			if !layer.Classify(x) {
+				excluded++
+			}
+		}
+		if exc := float64(excluded) / float64(len(neg)); exc < reqs.NegativeExclusion {
+			t.Errorf("mode %d: bad exclusion %f", reqs.Boosting, exc)
+		}
+	}
+}
+
+// A templateTestFeature is a custom feature which sums
+// the pixels in a rectangle.
+type templateTestFeature struct {
+	X      int
+	Y      int
+	Width  int
+	Height int
+}
+
+func (t *templateTestFeature) Value(img IntegralImage) float64 {
+	return img.IntegralAt(t.X+t.Width, t.Y+t.Height) + img.IntegralAt(t.X, t.Y) -
+		(img.IntegralAt(t.X+t.Width, t.Y) + img.IntegralAt(t.X, t.Y+t.Height))
+}
+
+func (t *templateTestFeature) Kind() string {
+	return "test-template"
+}
+
+// templateTestCascade creates a version of
+// scanTestCascade with template features.
+func templateTestCascade() *Cascade {
+	cascade := scanTestCascade()
+	cascade.Layers[0].Features[1] = &templateTestFeature{X: 1, Y: 2, Width: 5, Height: 3}
+	layer := cascade.Layers[1]
+	layer.Features[2] = &templateTestFeature{X: 4, Y: 0, Width: 4, Height: 8}
+	layer.Trees = []*DecisionTree{
+		nil,
+		nil,
+		{
+			Feature:   layer.Features[2],
+			Threshold: layer.Thresholds[2],
+			Low:       &DecisionTree{Output: -1},
+			High: &DecisionTree{
+				Feature:   &Feature{HorizontalPair, 0, 2, 8, 4},
+				Threshold: 0,
+				Low:       &DecisionTree{Output: 0.3},
+				High:      &DecisionTree{Output: 1},
+			},
+		},
+	}
+	return cascade
+}
+
+func floatSlicesEqual(s1, s2 []float64) bool {
+	if len(s1) != len(s2) {
+		return false
+	}
+	for i, x := range s1 {
+		if s2[i] != x {
+			return false
+		}
+	}
+	return true
+}